@@ -0,0 +1,318 @@
+package vars
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ExportArchive writes a tar archive of v's whole namespace directory to w,
+// including the unscoped store and every scope. Paths in the archive are
+// relative to the namespace directory. Anything other than directories and
+// regular files, such as symbolic links, is skipped.
+//
+// The unscoped store and every scope are read-locked for the duration of
+// the export, so that each is archived in a consistent state.
+//
+// ExportArchive is not supported by custom backends.
+func (v *Vars) ExportArchive(w io.Writer) error {
+	if v.backend != nil {
+		return fmt.Errorf("archives are not supported by a custom backend")
+	}
+	dir, err := v.sibling("").basePath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("vars not initialized for %q (run 'init' first)", v.namespace)
+		}
+		return err
+	}
+
+	scopes, err := v.Scopes()
+	if err != nil {
+		return err
+	}
+	locks := v.storeLocker(false)
+	defer locks.release()
+	if err := locks.acquireAll(scopes); err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// maxArchiveSize is the largest total size of the files in an archive that
+// [Vars.ImportArchive] accepts.
+const maxArchiveSize = 64 << 20
+
+// archiveEntry is a directory, or a regular file and its contents, read from
+// an archive.
+type archiveEntry struct {
+	name string
+	dir  bool
+	data []byte
+}
+
+// ImportArchive restores a tar archive written by [Vars.ExportArchive] into
+// v's namespace directory, creating it if necessary and overwriting files
+// that already exist. Directories and files are created with the configured
+// modes rather than those in the archive.
+//
+// Every entry must be a directory or regular file with a relative path that
+// stays within the namespace directory, and the files may total at most
+// 64 MiB. The archive is read and checked in full before anything is
+// written, so an invalid archive leaves the namespace untouched.
+//
+// The unscoped store and every store written by the archive are locked
+// while the files are extracted.
+func (v *Vars) ImportArchive(r io.Reader) error {
+	if v.backend != nil {
+		return fmt.Errorf("archives are not supported by a custom backend")
+	}
+	if err := v.checkModes(); err != nil {
+		return err
+	}
+	dir, err := v.sibling("").basePath()
+	if err != nil {
+		return err
+	}
+
+	entries, scopes, err := v.readArchive(r)
+	if err != nil {
+		return err
+	}
+
+	locks := v.storeLocker(true)
+	defer locks.release()
+	if err := locks.acquireAll(scopes); err != nil {
+		return err
+	}
+
+	if err := v.mkdirAll(dir); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	for _, e := range entries {
+		if e.dir {
+			if err := root.MkdirAll(e.name, v.dirMode); err != nil {
+				return err
+			}
+			if err := root.Chmod(e.name, v.dirMode); err != nil {
+				return err
+			}
+			continue
+		}
+		if parent := path.Dir(e.name); parent != "." {
+			if err := root.MkdirAll(parent, v.dirMode); err != nil {
+				return err
+			}
+		}
+		if err := extractFile(root, e.name, e.data, v.fileMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readArchive reads and checks every entry of the archive in r, returning
+// them along with the scopes of the stores their files belong to.
+func (v *Vars) readArchive(r io.Reader) ([]archiveEntry, []string, error) {
+	var entries []archiveEntry
+	var scopes []string
+	var size int64
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, scopes, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if !fs.ValidPath(name) || name == "." || strings.Contains(name, `\`) {
+			return nil, nil, fmt.Errorf("invalid path %q in archive", hdr.Name)
+		}
+		for _, seg := range strings.Split(name, "/") {
+			if !validName(seg) {
+				return nil, nil, fmt.Errorf("invalid path %q in archive", hdr.Name)
+			}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			entries = append(entries, archiveEntry{name: name, dir: true})
+		case tar.TypeReg:
+			data, err := io.ReadAll(io.LimitReader(tr, maxArchiveSize-size+1))
+			if err != nil {
+				return nil, nil, err
+			}
+			if size += int64(len(data)); size > maxArchiveSize {
+				return nil, nil, fmt.Errorf("archive exceeds %d bytes", maxArchiveSize)
+			}
+			entries = append(entries, archiveEntry{name: name, data: data})
+			if scope, ok := v.entryScope(name); ok {
+				scopes = append(scopes, scope)
+			}
+		default:
+			return nil, nil, fmt.Errorf("unsupported entry %q in archive", hdr.Name)
+		}
+	}
+}
+
+func extractFile(root *os.Root, name string, data []byte, mode os.FileMode) error {
+	f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// entryScope returns the scope of the store that name, a file path relative
+// to the namespace directory, belongs to, counting its sidecars and backups
+// as part of it. It reports false for files that belong to no store.
+func (v *Vars) entryScope(name string) (string, bool) {
+	dir, file := path.Split(name)
+	base, _, ok := strings.Cut(file, ".properties")
+	if !ok {
+		return "", false
+	}
+	switch {
+	case v.flatLayout && !(dir == "" && base == "vars"):
+		return path.Join(dir, base), true
+	case base != "vars":
+		return "", false
+	case dir == "":
+		return "", true
+	}
+	return strings.TrimSuffix(dir, "/"), true
+}
+
+// storeLocker holds the locks of several stores in v's namespace, each taken
+// at most once, for operations such as [Vars.ImportArchive] that span them.
+//
+// Locks spanning stores are always taken in the same order, scopes sorted
+// by name and then the namespace root, as [Vars.view] does when it holds a
+// scope's lock and takes the root's. Any other order could deadlock.
+type storeLocker struct {
+	v     *Vars
+	write bool
+	held  map[string]*sync.RWMutex
+}
+
+func (v *Vars) storeLocker(write bool) *storeLocker {
+	return &storeLocker{v: v, write: write, held: make(map[string]*sync.RWMutex)}
+}
+
+// acquireAll locks the stores of scopes, which may repeat and include the
+// root as "", and the root in any case, in lock order.
+func (l *storeLocker) acquireAll(scopes []string) error {
+	scopes = slices.Sorted(slices.Values(scopes))
+	for _, scope := range slices.Compact(scopes) {
+		if scope == "" {
+			continue
+		}
+		if err := l.acquire(scope); err != nil {
+			return err
+		}
+	}
+	return l.acquire("")
+}
+
+// acquire locks the store of scope unless it is already held, using v's lock
+// settings.
+func (l *storeLocker) acquire(scope string) error {
+	if l.v.noLock {
+		return nil
+	}
+	if _, ok := l.held[scope]; ok {
+		return nil
+	}
+	mu := l.v.sibling(scope).mutex()
+	var err error
+	if l.write {
+		err = l.v.acquire(mu.TryLock, mu.Lock, l.v.lockTimeout)
+	} else {
+		err = l.v.acquire(mu.TryRLock, mu.RLock, l.v.lockTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	l.held[scope] = mu
+	return nil
+}
+
+func (l *storeLocker) release() {
+	for _, mu := range l.held {
+		if l.write {
+			mu.Unlock()
+		} else {
+			mu.RUnlock()
+		}
+	}
+}
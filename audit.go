@@ -0,0 +1,63 @@
+package vars
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// WithAuditLog writes a line to w for every key added, changed or removed
+// by a successful write through Vars, such as [Vars.Set], [Vars.Unset] or
+// [Vars.InitForce]. Each line is a JSON object with the time, namespace,
+// scope, operation ("set" or "unset"), key, and the old and new values
+// where they exist:
+//
+//	{"time":"2025-01-01T12:00:00Z","namespace":"my-app","op":"set","key":"theme","old":"dark","new":"light"}
+//
+// A write that changes several keys writes one line for each, and a write
+// that leaves a key unchanged writes none. Values are recorded in full, so
+// w should be protected like the store itself. Lines are written while the
+// store is locked, so writes to w from a single Vars never interleave.
+func WithAuditLog(w io.Writer) Option {
+	return func(v *Vars) {
+		v.audit = w
+	}
+}
+
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Scope     string    `json:"scope,omitempty"`
+	Op        string    `json:"op"`
+	Key       string    `json:"key"`
+	Old       *string   `json:"old,omitempty"`
+	New       *string   `json:"new,omitempty"`
+}
+
+// auditChanges writes an audit line for each change that turned before into
+// after.
+func (v *Vars) auditChanges(before, after map[string]string) error {
+	if v.audit == nil {
+		return nil
+	}
+	now := v.now()
+	for _, ch := range diffMaps(before, after) {
+		e := auditEntry{Time: now, Namespace: v.namespace, Scope: v.scope, Op: "set", Key: ch.Key}
+		if ch.Kind != Added {
+			e.Old = &ch.Old
+		}
+		if ch.Kind == Removed {
+			e.Op = "unset"
+		} else {
+			e.New = &ch.New
+		}
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := v.audit.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
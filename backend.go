@@ -0,0 +1,344 @@
+package vars
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Backend persists the raw contents of a store.
+//
+// Implementations only move data to and from storage; namespace validation,
+// locking, and all higher-level behaviour remain in [Vars]. Load and Save are
+// always called with the store's lock held.
+type Backend interface {
+	// Load returns every stored key and value.
+	Load() (map[string]string, error)
+	// Save replaces the stored contents with data.
+	Save(data map[string]string) error
+}
+
+// WithBackend replaces the default vars.properties file with b.
+//
+// File-specific operations such as [Vars.Edit] are unavailable with a custom
+// backend, and [Vars.Init] only validates the namespace and scope.
+func WithBackend(b Backend) Option {
+	return func(v *Vars) {
+		v.backend = b
+	}
+}
+
+func (v *Vars) store() Backend {
+	if v.backend != nil {
+		return v.backend
+	}
+	return fileBackend{v}
+}
+
+// maxLineSize is the longest line accepted in vars.properties, allowing
+// large values such as certificate chains or encoded blobs.
+const maxLineSize = 16 << 20
+
+// fileBackend is the default [Backend], storing variables in a
+// vars.properties file beneath the XDG state directory.
+type fileBackend struct {
+	v *Vars
+}
+
+// commenter is implemented by backends that can keep a comment with each
+// key. When available it is used in place of Load and Save.
+type commenter interface {
+	LoadWithComments() (data, comments map[string]string, err error)
+	SaveWithComments(data, comments map[string]string) error
+}
+
+// appender is implemented by backends that can add a single new key without
+// rewriting everything.
+type appender interface {
+	Append(key, val string) error
+}
+
+func (b fileBackend) Load() (map[string]string, error) {
+	data, _, err := b.LoadWithComments()
+	return data, err
+}
+
+func (b fileBackend) Save(data map[string]string) error {
+	return b.SaveWithComments(data, nil)
+}
+
+// LoadWithComments reads vars.properties, see [Vars.decode].
+func (b fileBackend) LoadWithComments() (map[string]string, map[string]string, error) {
+	root, err := b.v.root()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to construct vars.properties path: %w", err)
+	}
+	defer root.Close()
+
+	file, err := root.Open(b.v.fileName())
+	if os.IsNotExist(err) {
+		return make(map[string]string), nil, fmt.Errorf("vars has not been initialized")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	return b.v.decode(file)
+}
+
+// Parse reads variables in the vars.properties format from r, using the
+// default delimiter and value trimming. It applies the same parsing the file
+// backend uses, so a store embedded with go:embed can be read without first
+// writing it to disk. Comments and blank lines are skipped. [Format] is the
+// reverse.
+func Parse(r io.Reader) (map[string]string, error) {
+	data, _, err := defaultCodec().decode(r)
+	return data, err
+}
+
+// Format writes data to w in the canonical vars.properties form: sorted by
+// key, with values escaped exactly as the file backend saves them.
+func Format(data map[string]string, w io.Writer) error {
+	content, err := defaultCodec().encode(data, nil)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+// defaultCodec returns a Vars carrying only the default format settings, for
+// encoding and decoding outside of any store.
+func defaultCodec() *Vars {
+	return &Vars{delimiter: "=", trimValues: true}
+}
+
+// decode parses the properties format. A run of "#" lines directly above
+// a key becomes that key's comment; other comments are ignored. If a key
+// appears more than once, the last occurrence wins. Lines without a
+// delimiter or with an empty key are skipped, or reported with
+// [WithStrictParse].
+func (v *Vars) decode(r io.Reader) (data, comments map[string]string, err error) {
+	data = make(map[string]string)
+	comments = make(map[string]string)
+
+	var pending []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			text := strings.TrimPrefix(line, "#")
+			pending = append(pending, strings.TrimPrefix(text, " "))
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			pending = nil
+			continue
+		}
+
+		key, val, ok := v.splitLine(line)
+		if v.strictParse && (!ok || key == "") {
+			return nil, nil, fmt.Errorf("vars.properties:%d: malformed line %q", n, line)
+		}
+		if ok && key != "" {
+			// The last occurrence of a duplicated key wins, along with its
+			// comment, matching the order in which appended lines are read.
+			data[key] = val
+			if pending != nil {
+				comments[key] = strings.Join(pending, "\n")
+			} else {
+				delete(comments, key)
+			}
+		}
+		pending = nil
+	}
+	return data, comments, scanner.Err()
+}
+
+// encode renders data in canonical form: sorted by key (see [WithKeyOrder]),
+// with each comment written as "# " lines directly above its key. Every line
+// ends with a newline, and an empty store is an empty file, unless
+// [WithFinalNewline] is set. It fails rather than write a key that would not
+// read back, see [Vars.checkKey].
+func (v *Vars) encode(data, comments map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		if err := v.checkKey(k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	v.sortKeys(keys)
+
+	for _, k := range keys {
+		if c, ok := comments[k]; ok {
+			for _, line := range strings.Split(c, "\n") {
+				buf.WriteString("# " + line + "\n")
+			}
+		}
+		buf.WriteString(k + v.delimiter + escape(data[k]) + "\n")
+	}
+
+	if v.finalNewline != nil {
+		if !*v.finalNewline {
+			buf.Truncate(max(buf.Len()-1, 0))
+		} else if buf.Len() == 0 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// checkKey reports an error if key cannot be stored as a single line that
+// parses back to the same key: it must not be empty, contain the delimiter
+// or a line break, begin with "#", or begin or end with whitespace, which
+// is trimmed when the file is read.
+func (v *Vars) checkKey(key string) error {
+	if strings.TrimSpace(key) == "" {
+		return fmt.Errorf("key cannot be empty")
+	}
+	if strings.Contains(key, v.delimiter) {
+		return fmt.Errorf("invalid key %q: contains the delimiter %q", key, v.delimiter)
+	}
+	if strings.ContainsAny(key, "\r\n") {
+		return fmt.Errorf("invalid key %q: contains a line break", key)
+	}
+	if strings.HasPrefix(key, "#") {
+		return fmt.Errorf("invalid key %q: begins with a comment marker", key)
+	}
+	if strings.TrimSpace(key) != key {
+		return fmt.Errorf("invalid key %q: begins or ends with whitespace", key)
+	}
+	return nil
+}
+
+// splitLine splits a key=value line into its unescaped parts, reporting
+// false if the line has no delimiter.
+func (v *Vars) splitLine(line string) (key, val string, ok bool) {
+	key, val, ok = strings.Cut(line, v.delimiter)
+	if !ok {
+		return "", "", false
+	}
+	if v.trimValues {
+		val = strings.TrimSpace(val)
+	}
+	return strings.TrimSpace(key), unescape(val), true
+}
+
+func (b fileBackend) SaveWithComments(data, comments map[string]string) error {
+	content, err := b.v.encode(data, comments)
+	if err != nil {
+		return err
+	}
+
+	if err := b.v.checkModes(); err != nil {
+		return err
+	}
+
+	root, err := b.v.root()
+	if err != nil {
+		return fmt.Errorf("unable to construct vars.properties path: %w", err)
+	}
+	defer root.Close()
+
+	if !b.v.fsync {
+		return root.WriteFile(b.v.fileName(), content, b.v.fileMode)
+	}
+
+	f, err := root.OpenFile(b.v.fileName(), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, b.v.fileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(content); err != nil {
+		return err
+	}
+	return b.sync(root, f)
+}
+
+// sync flushes f and the directory containing it to stable storage.
+func (b fileBackend) sync(root *os.Root, f *os.File) error {
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	dir, err := root.Open(".")
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed to sync state dir: %w", err)
+	}
+	return nil
+}
+
+// Append adds a key=value line to the end of vars.properties, starting a new
+// line first if the file does not already end with one. The line ends with a
+// newline unless [WithFinalNewline] is false.
+func (b fileBackend) Append(key, val string) error {
+	if err := b.v.checkKey(key); err != nil {
+		return err
+	}
+
+	root, err := b.v.root()
+	if err != nil {
+		return fmt.Errorf("unable to construct vars.properties path: %w", err)
+	}
+	defer root.Close()
+
+	if err := b.v.rotateBackups(root); err != nil {
+		return err
+	}
+	f, err := root.OpenFile(b.v.fileName(), os.O_RDWR|os.O_APPEND, b.v.fileMode)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	line := key + b.v.delimiter + escape(val)
+	if b.v.finalNewline == nil || *b.v.finalNewline {
+		line += "\n"
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if size := info.Size(); size > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, size-1); err != nil {
+			return err
+		}
+		if last[0] != '\n' {
+			line = "\n" + line
+		}
+	}
+
+	if _, err := f.WriteString(line); err != nil {
+		return err
+	}
+	if b.v.fsync {
+		return b.sync(root, f)
+	}
+	return f.Close()
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\n", "\\n"), "\r", "\\r")
+}
+
+func unescape(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\\n", "\n"), "\\r", "\r")
+}
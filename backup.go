@@ -0,0 +1,73 @@
+package vars
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// WithBackupOnWrite keeps the last n generations of the properties file as
+// an undo history. Before each write, the current file is copied to
+// vars.properties.1, after shifting older copies up to .2, .3 and so on;
+// the copy beyond n is removed. A store that does not exist yet has nothing
+// to back up. Zero, the default, keeps no backups.
+//
+// Backups are only made by the default file backend.
+func WithBackupOnWrite(n int) Option {
+	return func(v *Vars) {
+		v.backups = n
+	}
+}
+
+func (v *Vars) backupFile(gen int) string {
+	return v.fileName() + "." + strconv.Itoa(gen)
+}
+
+// rotator is implemented by backends that keep the backups of
+// [WithBackupOnWrite]. It is called once before each save, rather than by
+// the save itself, so that a save repeated by [WithRetry] does not shift the
+// backups again.
+type rotator interface {
+	rotateBackups() error
+}
+
+func (b fileBackend) rotateBackups() error {
+	root, err := b.v.root()
+	if err != nil {
+		return fmt.Errorf("unable to construct vars.properties path: %w", err)
+	}
+	defer root.Close()
+	return b.v.rotateBackups(root)
+}
+
+// rotateBackups copies the current file into the first backup generation
+// within root, shifting older generations and pruning those beyond the
+// limit, including any left by a larger earlier limit.
+func (v *Vars) rotateBackups(root *os.Root) error {
+	if v.backups <= 0 {
+		return nil
+	}
+	current, err := root.ReadFile(v.fileName())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to back up %s: %w", v.fileName(), err)
+	}
+
+	for gen := v.backups; ; gen++ {
+		if err := root.Remove(v.backupFile(gen)); os.IsNotExist(err) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	for gen := v.backups - 1; gen >= 1; gen-- {
+		err := root.Rename(v.backupFile(gen), v.backupFile(gen+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return writeFileMode(root, v.backupFile(1), current, v.fileMode)
+}
@@ -0,0 +1,130 @@
+package vars
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// WithChangeLog records every key added, changed or removed through Vars,
+// keeping the most recent limit entries for [Vars.ChangeLog]. The entries
+// are kept in a sidecar file next to the properties file, named after it
+// with a ".log" suffix, as one JSON object per line; older entries are
+// dropped as new ones are written, so the file never grows beyond limit
+// lines. A limit of zero or less disables the log.
+//
+// The log keeps the old and new value of each change in plain text, so a
+// value stays in it after its key is unset or overwritten, and it is
+// included by [Vars.ExportArchive]. Enable it only where the sidecar can be
+// protected like the store itself.
+//
+// As with [WithKeyTimestamps], edits made directly to the file are not
+// recorded, and the log is not supported by custom backends.
+func WithChangeLog(limit int) Option {
+	return func(v *Vars) {
+		v.changeLog = limit
+	}
+}
+
+// LogEntry is a change recorded by [WithChangeLog], with the time it was
+// written.
+type LogEntry struct {
+	Time time.Time `json:"time"`
+	Change
+}
+
+// ChangeLog returns the recorded changes, oldest first. It requires
+// [WithChangeLog]; a store that has not been written since the log was
+// enabled has no entries.
+func (v *Vars) ChangeLog() ([]LogEntry, error) {
+	if v.changeLog <= 0 {
+		return nil, fmt.Errorf("the change log is not enabled (see WithChangeLog)")
+	}
+	if v.backend != nil {
+		return nil, fmt.Errorf("the change log is not supported by a custom backend")
+	}
+
+	if err := v.rlock(); err != nil {
+		return nil, err
+	}
+	defer v.runlock()
+
+	return v.loadLog()
+}
+
+func (v *Vars) logFile() string {
+	return v.fileName() + ".log"
+}
+
+// loadLog reads the sidecar file. A missing file holds no entries.
+func (v *Vars) loadLog() ([]LogEntry, error) {
+	root, err := v.root()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	raw, err := root.ReadFile(v.logFile())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []LogEntry
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+	for n := 1; scanner.Scan(); n++ {
+		var e LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid entry: %w", v.logFile(), n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// logChanges appends the changes that turned before into after to the
+// sidecar file, dropping the oldest entries beyond the limit.
+func (v *Vars) logChanges(before, after map[string]string) error {
+	if v.changeLog <= 0 || v.backend != nil {
+		return nil
+	}
+	changes := diffMaps(before, after)
+	if len(changes) == 0 {
+		return nil
+	}
+	entries, err := v.loadLog()
+	if err != nil {
+		return err
+	}
+
+	now := v.now()
+	for _, ch := range changes {
+		entries = append(entries, LogEntry{Time: now, Change: ch})
+	}
+	if len(entries) > v.changeLog {
+		entries = entries[len(entries)-v.changeLog:]
+	}
+
+	var buf bytes.Buffer
+	for _, e := range entries {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	root, err := v.root()
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	return writeFileMode(root, v.logFile(), buf.Bytes(), v.fileMode)
+}
@@ -1,10 +1,6 @@
 package vars
 
-import (
-	"sort"
-
-	"github.com/spf13/cobra"
-)
+import "github.com/spf13/cobra"
 
 // NewCmd returns a [cobra.Command] for managing persistent variables.
 //
@@ -16,25 +12,33 @@ import (
 // The returned command contains subcommands for standard operations:
 //  1. init: Initialize the storage.
 //  2. set/unset: Write changes to the store.
-//  3. get/data/keys: Read values from the store.
+//  3. get/data/keys/values/cat: Read values from the store.
 //  4. edit: Open the store in the user's preferred editor.
+//  5. path: Print the location of the store.
 func NewCmd(namespace string, scope ...string) *cobra.Command {
 	if len(scope) > 1 {
 		panic("vars: strict mode allows only a single level of scope")
 	}
+	return newCmd(New(namespace, scope...))
+}
 
-	currentScope := ""
-	if len(scope) > 0 {
-		currentScope = scope[0]
+// NewCmdE is like [NewCmd] but validates the namespace and scope up front
+// (see [NewValidated]), returning an error instead of panicking when given
+// more than one scope.
+func NewCmdE(namespace string, scope ...string) (*cobra.Command, error) {
+	v, err := NewValidated(namespace, scope...)
+	if err != nil {
+		return nil, err
 	}
+	return newCmd(v), nil
+}
 
-	desc := namespace
-	if currentScope != "" {
-		desc += "/" + currentScope
+func newCmd(v *Vars) *cobra.Command {
+	desc := v.namespace
+	if v.scope != "" {
+		desc += "/" + v.scope
 	}
 
-	v := New(namespace, scope...)
-
 	cmd := &cobra.Command{
 		Use:           "vars",
 		Short:         "Manage variables for " + desc,
@@ -42,39 +46,67 @@ func NewCmd(namespace string, scope ...string) *cobra.Command {
 		SilenceErrors: true,
 	}
 
-	cmd.AddCommand(&cobra.Command{
+	var force bool
+	initCmd := &cobra.Command{
 		Use:   "init",
 		Short: "initialize empty vars file for <name>",
 		Args:  cobra.NoArgs,
 		RunE: func(c *cobra.Command, _ []string) error {
+			if force {
+				return v.InitForce()
+			}
 			return v.Init()
 		},
-	})
+	}
+	initCmd.Flags().BoolVarP(&force, "force", "f", false, "reset an existing vars file to empty")
+	cmd.AddCommand(initCmd)
 
-	cmd.AddCommand(&cobra.Command{
+	var ifNotExists bool
+	setCmd := &cobra.Command{
 		Use:   "set <key> <value>",
 		Short: "Set a variable",
 		Args:  cobra.ExactArgs(2),
 		RunE: func(c *cobra.Command, args []string) error {
+			if ifNotExists {
+				_, err := v.SetIfAbsent(args[0], args[1])
+				return err
+			}
 			return v.Set(args[0], args[1])
 		},
-	})
+	}
+	setCmd.Flags().BoolVar(&ifNotExists, "if-not-exists", false, "only set the variable if it is not already set")
+	cmd.AddCommand(setCmd)
 
-	cmd.AddCommand(&cobra.Command{
+	var unsetGlob bool
+	unsetCmd := &cobra.Command{
 		Use:   "unset <key>",
 		Short: "Unset a variable property key value",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(c *cobra.Command, args []string) error {
+			if unsetGlob {
+				_, err := v.UnsetMatch(args[0])
+				return err
+			}
 			return v.Unset(args[0])
 		},
-	})
+	}
+	unsetCmd.Flags().BoolVar(&unsetGlob, "glob", false, "treat <key> as a glob pattern")
+	cmd.AddCommand(unsetCmd)
+
+	selectData := func(glob string) (map[string]string, error) {
+		if glob == "" {
+			return v.All()
+		}
+		return v.Match(glob)
+	}
 
-	cmd.AddCommand(&cobra.Command{
+	var dataGlob string
+	dataCmd := &cobra.Command{
 		Use:   "data",
 		Short: "Prints all vars",
 		Args:  cobra.NoArgs,
 		RunE: func(c *cobra.Command, args []string) error {
-			data, err := v.All()
+			data, err := selectData(dataGlob)
 			if err != nil {
 				return err
 			}
@@ -83,14 +115,16 @@ func NewCmd(namespace string, scope ...string) *cobra.Command {
 			for k := range data {
 				keys = append(keys, k)
 			}
-			sort.Strings(keys)
+			v.sortKeys(keys)
 
 			for _, k := range keys {
 				c.Printf("%s=%s\n", k, data[k])
 			}
 			return nil
 		},
-	})
+	}
+	dataCmd.Flags().StringVar(&dataGlob, "glob", "", "only print keys matching the glob pattern")
+	cmd.AddCommand(dataCmd)
 
 	cmd.AddCommand(&cobra.Command{
 		Use:   "edit",
@@ -102,12 +136,41 @@ func NewCmd(namespace string, scope ...string) *cobra.Command {
 	})
 
 	cmd.AddCommand(&cobra.Command{
+		Use:   "cat",
+		Short: "Prints the raw vars file",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			raw, err := v.Raw()
+			if err != nil {
+				return err
+			}
+			c.Print(string(raw))
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "path",
+		Short: "Print the path to the vars file",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			path, err := v.Path()
+			if err != nil {
+				return err
+			}
+			c.Println(path)
+			return nil
+		},
+	})
+
+	var keysGlob string
+	keysCmd := &cobra.Command{
 		Use:     "keys",
 		Aliases: []string{"k"},
 		Short:   "Prints all keys",
 		Args:    cobra.NoArgs,
 		RunE: func(c *cobra.Command, args []string) error {
-			data, err := v.All()
+			data, err := selectData(keysGlob)
 			if err != nil {
 				return err
 			}
@@ -116,13 +179,31 @@ func NewCmd(namespace string, scope ...string) *cobra.Command {
 			for k := range data {
 				keys = append(keys, k)
 			}
-			sort.Strings(keys)
+			v.sortKeys(keys)
 
 			for _, k := range keys {
 				c.Printf("%s\n", k)
 			}
 			return nil
 		},
+	}
+	keysCmd.Flags().StringVar(&keysGlob, "glob", "", "only print keys matching the glob pattern")
+	cmd.AddCommand(keysCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "values",
+		Short: "Prints all values in key order",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, _ []string) error {
+			vals, err := v.Values()
+			if err != nil {
+				return err
+			}
+			for _, val := range vals {
+				c.Println(val)
+			}
+			return nil
+		},
 	})
 
 	cmd.AddCommand(&cobra.Command{
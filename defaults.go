@@ -0,0 +1,61 @@
+package vars
+
+import "maps"
+
+// RegisterDefault records value as the default for key, to be restored by
+// [Vars.Reset]. Registering a key again replaces its default. Defaults are
+// held in memory only and are never written to the store; a key that
+// cannot be stored, such as an empty one, is reported when Reset writes it.
+func (v *Vars) RegisterDefault(key, value string) {
+	// Defaults are registered during setup, which waits for the lock
+	// regardless of WithLockTimeout.
+	v.acquireLock(0)
+	defer v.unlock()
+
+	if v.defaults == nil {
+		v.defaults = make(map[string]string)
+	}
+	v.defaults[v.key(key)] = value
+}
+
+// WithDefaultFallback makes [Vars.Get] return the default registered with
+// [Vars.RegisterDefault] for a key that is not stored, instead of an error.
+func WithDefaultFallback() Option {
+	return func(v *Vars) {
+		v.defaultFallback = true
+	}
+}
+
+// Reset restores key to the value registered with [Vars.RegisterDefault], or
+// removes it if no default is registered.
+func (v *Vars) Reset(key string) error {
+	key = v.key(key)
+	err := v.update(func(m map[string]string) error {
+		if def, ok := v.defaults[key]; ok {
+			m[key] = def
+		} else {
+			delete(m, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	v.emit("reset", key, nil)
+	return nil
+}
+
+// ResetAll restores every key with a registered default to that default and
+// removes every other key, in a single save.
+func (v *Vars) ResetAll() error {
+	err := v.update(func(m map[string]string) error {
+		clear(m)
+		maps.Copy(m, v.defaults)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	v.emit("reset", "", nil)
+	return nil
+}
@@ -0,0 +1,97 @@
+package vars
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ChangeKind describes how a key differs between two sets of variables.
+type ChangeKind int
+
+const (
+	// Added keys are missing from the store.
+	Added ChangeKind = iota + 1
+	// Changed keys are in both, with different values.
+	Changed
+	// Removed keys are only in the store.
+	Removed
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Changed:
+		return "changed"
+	case Removed:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes k by name, such as "added".
+func (k ChangeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes a kind written by [ChangeKind.MarshalText].
+func (k *ChangeKind) UnmarshalText(text []byte) error {
+	for _, kind := range []ChangeKind{Added, Changed, Removed} {
+		if string(text) == kind.String() {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown change kind %q", text)
+}
+
+// Change is a single difference reported by [Vars.Diff]. Old is empty for an
+// added key and New is empty for a removed one.
+type Change struct {
+	Key  string     `json:"key"`
+	Kind ChangeKind `json:"kind"`
+	Old  string     `json:"old,omitempty"`
+	New  string     `json:"new,omitempty"`
+}
+
+// Diff compares the store against want and returns, sorted by key, the
+// changes that would make the store match it. Comments are ignored.
+func (v *Vars) Diff(want map[string]string) ([]Change, error) {
+	have, err := v.All()
+	if err != nil {
+		return nil, err
+	}
+	want, err = v.foldKeys(want)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffMaps(have, want), nil
+}
+
+// diffMaps returns, sorted by key, the changes that turn have into want.
+func diffMaps(have, want map[string]string) []Change {
+	keys := slices.Sorted(maps.Keys(have))
+	for k := range want {
+		if _, ok := have[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	var changes []Change
+	for _, k := range keys {
+		old, inHave := have[k]
+		val, inWant := want[k]
+		switch {
+		case !inHave:
+			changes = append(changes, Change{Key: k, Kind: Added, New: val})
+		case !inWant:
+			changes = append(changes, Change{Key: k, Kind: Removed, Old: old})
+		case old != val:
+			changes = append(changes, Change{Key: k, Kind: Changed, Old: old, New: val})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,89 @@
+package vars
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// defaultEditor is the editor used when neither VISUAL nor EDITOR is set.
+var defaultEditor = fallbackEditor(runtime.GOOS)
+
+// fallbackEditor returns an editor that is present by default on goos:
+// notepad on Windows and vi elsewhere.
+func fallbackEditor(goos string) string {
+	if goos == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// splitWords splits an editor command line such as
+// `"/Applications/My Editor" --wait` into words, honouring shell-style
+// quoting. Single quotes preserve everything up to the closing quote. Within
+// double quotes, and outside quotes, a backslash escapes only a quote, a
+// backslash or, outside quotes, a space; any other backslash is kept so that
+// Windows paths such as C:\Tools\edit.exe work unquoted.
+func splitWords(s string) ([]string, error) {
+	var (
+		words []string
+		word  strings.Builder
+		// inWord is set once a word has started, so that an empty quoted
+		// argument such as "" still produces a word.
+		inWord bool
+		quote  rune
+	)
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\' && i+1 < len(runes) && escapable(runes[i+1], quote):
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// escapable reports whether a backslash before r escapes it, given the
+// enclosing quote, if any.
+func escapable(r, quote rune) bool {
+	switch r {
+	case '"', '\\':
+		return true
+	case ' ', '\'':
+		return quote == 0
+	}
+	return false
+}
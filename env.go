@@ -0,0 +1,188 @@
+package vars
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// envKeyReplacer maps characters allowed in keys but not in environment
+// variable names onto underscores.
+var envKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// Environ returns the stored variables as "PREFIX_KEY=value" strings sorted
+// by key, suitable for [os/exec.Cmd.Env]. Keys are uppercased with "." and
+// "-" replaced by "_". An empty prefix omits the "PREFIX_" part.
+//
+// It returns an error naming the keys concerned if a key does not yield a
+// valid environment variable name, or if several keys yield the same one,
+// as "db.host" and "db-host" do.
+//
+//	cmd.Env = append(os.Environ(), env...)
+func (v *Vars) Environ(prefix string) ([]string, error) {
+	m, err := v.All()
+	if err != nil {
+		return nil, err
+	}
+	keys, names, err := envNames(prefix, m)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make([]string, len(keys))
+	for i, k := range keys {
+		env[i] = names[i] + "=" + m[k]
+	}
+	return env, nil
+}
+
+func envKey(prefix, key string) string {
+	name := strings.ToUpper(envKeyReplacer.Replace(key))
+	if prefix != "" {
+		name = strings.ToUpper(prefix) + "_" + name
+	}
+	return name
+}
+
+// envNames returns the keys of data in sorted order along with their
+// environment variable names, failing if a name is not a valid identifier
+// or is shared by two keys.
+func envNames(prefix string, data map[string]string) (keys, names []string, err error) {
+	keys = slices.Sorted(maps.Keys(data))
+	names = make([]string, len(keys))
+	owner := make(map[string]string, len(keys))
+	for i, k := range keys {
+		name := envKey(prefix, k)
+		if !validEnvName(name) {
+			return nil, nil, fmt.Errorf("key %q does not map to a valid environment variable name (got %q)", k, name)
+		}
+		if other, ok := owner[name]; ok {
+			return nil, nil, fmt.Errorf("keys %q and %q both map to the environment variable %s", other, k, name)
+		}
+		owner[name] = k
+		names[i] = name
+	}
+	return keys, names, nil
+}
+
+// validEnvName reports whether name is made of letters, digits and
+// underscores and does not begin with a digit, the portable form accepted by
+// every shell.
+func validEnvName(name string) bool {
+	for i, r := range name {
+		switch {
+		case r == '_', 'A' <= r && r <= 'Z', 'a' <= r && r <= 'z':
+		case '0' <= r && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// envValueReplacer escapes a value for a double-quoted dotenv value.
+var envValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`)
+
+// WithMirrorEnvFile makes every write also replace the file at path with a
+// dotenv copy of the store, for tools that read a .env file. Each variable
+// is written as KEY="value", sorted by key, with keys named as by
+// [Vars.Environ] without a prefix and values double-quoted and escaped. Keys
+// that Environ would reject make the mirror fail in the same way.
+//
+// The mirror is written to a temporary file in the same directory and
+// renamed into place, so readers never see a partial file. It is written
+// after the store is saved: if it fails, the write returns an error saying
+// so, but the store itself has been updated.
+func WithMirrorEnvFile(path string) Option {
+	return func(v *Vars) {
+		v.envMirror = path
+	}
+}
+
+// mirrorEnv writes data to the file set by [WithMirrorEnvFile].
+func (v *Vars) mirrorEnv(data map[string]string) error {
+	if v.envMirror == "" {
+		return nil
+	}
+	keys, names, err := envNames("", data)
+	if err != nil {
+		return fmt.Errorf("vars saved, but failed to mirror them to %s: %w", v.envMirror, err)
+	}
+	var buf bytes.Buffer
+	for i, k := range keys {
+		buf.WriteString(names[i] + `="` + envValueReplacer.Replace(data[k]) + "\"\n")
+	}
+	if err := writeFileAtomic(v.envMirror, buf.Bytes(), v.fileMode); err != nil {
+		return fmt.Errorf("vars saved, but failed to mirror them to %s: %w", v.envMirror, err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the file at path with content by renaming a
+// temporary file written beside it.
+func writeFileAtomic(path string, content []byte, mode os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := f.Write(content); err != nil {
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// WithStrictExpand makes [Vars.GetExpanded] return an error for a reference
+// to an environment variable that is not set, instead of expanding it to an
+// empty string.
+func WithStrictExpand() Option {
+	return func(v *Vars) {
+		v.strictExpand = true
+	}
+}
+
+// GetExpanded returns the value of key like [Vars.Get], with a leading "~"
+// or "~/" replaced by the user's home directory and "$VAR" and "${VAR}"
+// references replaced by environment variables, as for [os.ExpandEnv]. An
+// unset variable expands to an empty string unless [WithStrictExpand] is
+// set. Unlike [Vars.Render], references name environment variables rather
+// than other keys.
+func (v *Vars) GetExpanded(key string) (string, error) {
+	val, err := v.Get(key)
+	if err != nil {
+		return "", err
+	}
+
+	if rest, ok := strings.CutPrefix(val, "~"); ok && (rest == "" || rest[0] == '/') {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to expand %q for key %q: %w", val, key, err)
+		}
+		val = home + rest
+	}
+
+	var missing []string
+	val = os.Expand(val, func(name string) string {
+		env, ok := os.LookupEnv(name)
+		if !ok && !slices.Contains(missing, name) {
+			missing = append(missing, name)
+		}
+		return env
+	})
+	if v.strictExpand && len(missing) > 0 {
+		return "", fmt.Errorf("undefined environment variable %s in key %q", strings.Join(missing, ", "), key)
+	}
+	return val, nil
+}
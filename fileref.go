@@ -0,0 +1,76 @@
+package vars
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fileRefPrefix marks a value that refers to a file, see [WithFileRefs].
+const fileRefPrefix = "@file:"
+
+// maxFileRefSize is the largest file a reference may resolve to.
+const maxFileRefSize = 1 << 20
+
+// WithFileRefs makes [Vars.Get], [Vars.Lookup] and [Vars.GetMany] resolve
+// values of the form "@file:/run/secrets/token" to the contents of the
+// named file, so that sensitive values need not be stored inline. [Vars.Set]
+// stores such references literally, and reads of the whole store, such as
+// [Vars.All], return them unresolved.
+//
+// References are confined to dir: the path must be absolute, free of ".."
+// segments and inside dir, and is opened within dir so that a symbolic link
+// leading out of it is refused. It must name a regular file of at most
+// 1 MiB. An empty dir leaves references unresolved.
+func WithFileRefs(dir string) Option {
+	return func(v *Vars) {
+		v.fileRefDir = dir
+	}
+}
+
+// resolveFileRef returns the contents of the file referred to by val, or val
+// itself if it is not a reference or [WithFileRefs] is not set.
+func (v *Vars) resolveFileRef(val string) (string, error) {
+	path, ok := strings.CutPrefix(val, fileRefPrefix)
+	if v.fileRefDir == "" || !ok {
+		return val, nil
+	}
+	if !filepath.IsAbs(path) || filepath.Clean(path) != filepath.FromSlash(path) {
+		return "", fmt.Errorf("invalid file reference %q: path must be absolute and clean", path)
+	}
+	rel, err := filepath.Rel(v.fileRefDir, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("invalid file reference %q: path is outside %s", path, v.fileRefDir)
+	}
+
+	root, err := os.OpenRoot(v.fileRefDir)
+	if err != nil {
+		return "", fmt.Errorf("unable to read file reference: %w", err)
+	}
+	defer root.Close()
+
+	f, err := root.Open(rel)
+	if err != nil {
+		return "", fmt.Errorf("unable to read file reference: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("invalid file reference %q: not a regular file", path)
+	}
+
+	b, err := io.ReadAll(io.LimitReader(f, maxFileRefSize+1))
+	if err != nil {
+		return "", fmt.Errorf("unable to read file reference: %w", err)
+	}
+	if len(b) > maxFileRefSize {
+		return "", fmt.Errorf("file reference %q exceeds %d bytes", path, maxFileRefSize)
+	}
+	return string(b), nil
+}
@@ -1,20 +1,49 @@
 package standalone
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rwx-yxu/vars"
 	"github.com/spf13/cobra"
 )
 
 func Execute() {
+	os.Exit(execute(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// execute runs the CLI with the given arguments and returns the process exit
+// code. Errors are written to stderr, as JSON when --output json is set.
+// Long-running commands such as watch stop when ctx is cancelled.
+func execute(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
 	root := cmd()
-	if err := root.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	root.SetArgs(args)
+	root.SetIn(stdin)
+	root.SetOut(stdout)
+	root.SetErr(stderr)
+
+	if err := root.ExecuteContext(ctx); err != nil {
+		if output, _ := root.PersistentFlags().GetString("output"); output == "json" {
+			json.NewEncoder(stderr).Encode(map[string]string{"error": err.Error()})
+		} else {
+			fmt.Fprintln(stderr, err)
+		}
+		return 1
 	}
+	return 0
 }
 
 func cmd() *cobra.Command {
@@ -23,53 +52,223 @@ func cmd() *cobra.Command {
 		Short:         "Manage stateful properties for any application",
 		SilenceUsage:  true,
 		SilenceErrors: true,
+		Long: "Manage stateful properties for any application.\n\n" +
+			"Commands select a store with <name> [scope], with a single\n" +
+			"<name>/<scope> argument, or with <name> and --scope; for example\n" +
+			"\"vars get my-app/dev theme\" or \"vars get --scope dev my-app theme\".",
 	}
 
-	cmd.AddCommand(&cobra.Command{
+	var quiet bool
+	cmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Suppress informational output")
+
+	var output string
+	cmd.PersistentFlags().StringVarP(&output, "output", "o", "text", "Output format (text or json)")
+	cmd.PersistentFlags().StringP("scope", "s", "", "Scope to select, instead of a positional [scope] (\"\" for the namespace root)")
+	cmd.PersistentPreRunE = func(c *cobra.Command, _ []string) error {
+		if output != "text" && output != "json" {
+			return fmt.Errorf("invalid output format %q (want text or json)", output)
+		}
+		return nil
+	}
+
+	// info prints informational messages that --quiet suppresses. Requested
+	// data, such as the output of get, is always printed. Informational
+	// messages are omitted from JSON output.
+	info := func(c *cobra.Command, a ...any) {
+		if !quiet && output != "json" {
+			c.Println(a...)
+		}
+	}
+
+	// confirm asks question on stderr and reads the answer from stdin,
+	// reporting whether it was yes. Any other answer prints "Aborted".
+	confirm := func(c *cobra.Command, question string) (bool, error) {
+		fmt.Fprintf(c.ErrOrStderr(), "%s [y/N]: ", question)
+		line, err := bufio.NewReader(c.InOrStdin()).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		answer := strings.ToLower(strings.TrimSpace(line))
+		if answer != "y" && answer != "yes" {
+			info(c, "Aborted")
+			return false, nil
+		}
+		return true, nil
+	}
+
+	// result prints the result of a command, encoding v as JSON with
+	// --output json and calling text otherwise.
+	result := func(c *cobra.Command, v any, text func()) error {
+		if output == "json" {
+			return json.NewEncoder(c.OutOrStdout()).Encode(v)
+		}
+		text()
+		return nil
+	}
+
+	var force bool
+	initCmd := &cobra.Command{
 		Use:   "init <name> [scope]",
 		Short: "Initialize vars (Required before use)",
 		Args:  cobra.RangeArgs(1, 2),
 		RunE: func(c *cobra.Command, args []string) error {
-			ns, scope := parseArgs(args)
-			v := vars.New(ns, scope...)
-			if err := v.Init(); err != nil {
+			ns, scope := parseArgs(c, args)
+			v := newVars(ns, scope...)
+			var err error
+			if force {
+				err = v.InitForce()
+			} else {
+				err = v.Init()
+			}
+			if err != nil {
 				return err
 			}
-			c.Println("Initialized vars properties")
+			info(c, "Initialized vars properties")
 			return nil
 		},
-	})
+	}
+	initCmd.Flags().BoolVarP(&force, "force", "f", false, "Reset an existing vars file to empty")
+	cmd.AddCommand(initCmd)
 
-	cmd.AddCommand(&cobra.Command{
+	var ifNotExists bool
+	var setComment, setType string
+	setCmd := &cobra.Command{
 		Use:   "set <name> [scope] <key> <value>",
 		Short: "Set a variable for a specific property",
 		Args:  cobra.RangeArgs(3, 4),
 		RunE: func(c *cobra.Command, args []string) error {
 			key := args[len(args)-2]
 			val := args[len(args)-1]
-			ns, scope := parseArgs(args[:len(args)-2])
-			return vars.New(ns, scope...).Set(key, val)
+			if setType != "" {
+				var err error
+				if val, err = vars.CanonicalValue(setType, val); err != nil {
+					return err
+				}
+			}
+			ns, scope := parseArgs(c, args[:len(args)-2])
+			v := newVars(ns, scope...)
+			commented := c.Flags().Changed("comment")
+			if ifNotExists {
+				if commented {
+					return fmt.Errorf("--comment cannot be used with --if-not-exists")
+				}
+				_, err := v.SetIfAbsent(key, val)
+				return err
+			}
+			if commented {
+				return v.SetWithComment(key, val, setComment)
+			}
+			return v.Set(key, val)
 		},
-	})
+	}
+	setCmd.Flags().BoolVar(&ifNotExists, "if-not-exists", false, "Only set the variable if it is not already set")
+	setCmd.Flags().StringVar(&setComment, "comment", "", "Attach a comment to the variable (an empty comment removes it)")
+	setCmd.Flags().StringVar(&setType, "type", "", "Validate the value as int, bool, float or duration and store it in canonical form")
+	cmd.AddCommand(setCmd)
 
 	cmd.AddCommand(&cobra.Command{
-		Use:   "unset <name> [scope] <key>",
-		Short: "Unset a variable property key value",
-		Args:  cobra.RangeArgs(2, 3),
+		Use:   "mset <name> [scope] <key=value>...",
+		Short: "Set several variables at once",
+		Long: "Set several variables at once, each given as key=value and split on\n" +
+			"the first \"=\". All variables are written in a single save.",
+		Args: cobra.MinimumNArgs(2),
 		RunE: func(c *cobra.Command, args []string) error {
-			key := args[len(args)-1]
-			ns, scope := parseArgs(args[:len(args)-1])
-			return vars.New(ns, scope...).Unset(key)
+			// Scopes cannot contain "=", so a second argument without one is
+			// the scope rather than a pair.
+			n := 1
+			if len(args) > 2 && !strings.Contains(args[1], "=") {
+				n = 2
+			}
+			pairs := make(map[string]string, len(args)-n)
+			for _, arg := range args[n:] {
+				key, val, ok := strings.Cut(arg, "=")
+				if !ok {
+					return fmt.Errorf("invalid pair %q (want key=value)", arg)
+				}
+				pairs[key] = val
+			}
+
+			ns, scope := parseArgs(c, args[:n])
+			if err := newVars(ns, scope...).SetMany(pairs); err != nil {
+				return err
+			}
+			info(c, fmt.Sprintf("Set %d vars", len(pairs)))
+			return nil
 		},
 	})
 
-	cmd.AddCommand(&cobra.Command{
+	var unsetGlob bool
+	unsetCmd := &cobra.Command{
+		Use:               "unset <name> [scope] <key>",
+		Short:             "Unset a variable property key value",
+		ValidArgsFunction: completeKeys,
+		Args:              cobra.RangeArgs(2, 3),
+		RunE: func(c *cobra.Command, args []string) error {
+			key := args[len(args)-1]
+			ns, scope := parseArgs(c, args[:len(args)-1])
+			v := newVars(ns, scope...)
+			if unsetGlob {
+				_, err := v.UnsetMatch(key)
+				return err
+			}
+			return v.Unset(key)
+		},
+	}
+	unsetCmd.Flags().BoolVar(&unsetGlob, "glob", false, "Treat <key> as a glob pattern")
+	cmd.AddCommand(unsetCmd)
+
+	var resetAll, resetForce bool
+	resetCmd := &cobra.Command{
+		Use:   "reset <name> [scope] <key>",
+		Short: "Reset a variable, or with --all every variable",
+		Long: "Reset a variable to its default. The standalone CLI registers no\n" +
+			"defaults, so this removes the variable; with --all every variable\n" +
+			"is removed and only <name> [scope] is given. --all asks for\n" +
+			"confirmation on stdin unless --force is given.",
+		ValidArgsFunction: completeKeys,
+		Args: func(c *cobra.Command, args []string) error {
+			if resetAll {
+				return cobra.RangeArgs(1, 2)(c, args)
+			}
+			return cobra.RangeArgs(2, 3)(c, args)
+		},
+		RunE: func(c *cobra.Command, args []string) error {
+			if resetAll {
+				ns, scope := parseArgs(c, args)
+				v := newVars(ns, scope...)
+				if !resetForce {
+					path, err := v.Path()
+					if err != nil {
+						return err
+					}
+					if ok, err := confirm(c, "Remove every variable in "+path+"?"); err != nil || !ok {
+						return err
+					}
+				}
+				if err := v.ResetAll(); err != nil {
+					return err
+				}
+				info(c, "Reset all vars properties")
+				return nil
+			}
+			key := args[len(args)-1]
+			ns, scope := parseArgs(c, args[:len(args)-1])
+			return newVars(ns, scope...).Reset(key)
+		},
+	}
+	resetCmd.Flags().BoolVar(&resetAll, "all", false, "Reset every variable")
+	resetCmd.Flags().BoolVarP(&resetForce, "force", "f", false, "Reset every variable without asking for confirmation")
+	resetCmd.Flags().BoolVarP(&resetForce, "yes", "y", false, "Alias for --force")
+	cmd.AddCommand(resetCmd)
+
+	var dataGlob string
+	dataCmd := &cobra.Command{
 		Use:   "data <name> [scope]",
 		Short: "Prints all vars for given name",
 		Args:  cobra.RangeArgs(1, 2),
 		RunE: func(c *cobra.Command, args []string) error {
-			ns, scope := parseArgs(args)
-			data, err := vars.New(ns, scope...).All()
+			ns, scope := parseArgs(c, args)
+			data, err := selectData(newVars(ns, scope...), dataGlob)
 			if err != nil {
 				return err
 			}
@@ -80,31 +279,548 @@ func cmd() *cobra.Command {
 			}
 			sort.Strings(keys)
 
-			for _, k := range keys {
-				c.Printf("%s=%s\n", k, data[k])
+			return result(c, data, func() {
+				for _, k := range keys {
+					c.Printf("%s=%s\n", k, data[k])
+				}
+			})
+		},
+	}
+	dataCmd.Flags().StringVar(&dataGlob, "glob", "", "Only print keys matching the glob pattern")
+	cmd.AddCommand(dataCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "data-all",
+		Short: "Prints all vars for every name and scope",
+		Long: "Prints all vars for every name and scope in the state directory.\n" +
+			"Each store is introduced by a [name] or [name/scope] header line\n" +
+			"and followed by a blank line.",
+		Args: cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			namespaces, err := vars.ListNamespaces()
+			if err != nil {
+				return err
+			}
+
+			var sections []string
+			all := make(map[string]map[string]string)
+			for _, ns := range namespaces {
+				scopes, err := newVars(ns).Scopes()
+				if err != nil {
+					return err
+				}
+				stores := map[string]*vars.Vars{ns: newVars(ns)}
+				for _, s := range scopes {
+					stores[ns+"/"+s] = newVars(ns, s)
+				}
+				for name, v := range stores {
+					if ok, _ := v.IsInitialized(); !ok {
+						continue
+					}
+					data, err := v.All()
+					if err != nil {
+						return err
+					}
+					all[name] = data
+					sections = append(sections, name)
+				}
+			}
+			sort.Strings(sections)
+
+			return result(c, all, func() {
+				for _, name := range sections {
+					c.Printf("[%s]\n", name)
+					data := all[name]
+					keys := make([]string, 0, len(data))
+					for k := range data {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					for _, k := range keys {
+						c.Printf("%s=%s\n", k, data[k])
+					}
+					c.Println()
+				}
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "diff <name> [scope] <file>",
+		Short: "Compare the vars for given name against a file",
+		Long: "Compare the vars for given name against a key=value or JSON file,\n" +
+			"printing keys the file adds (+), changes (~) or removes (-).\n" +
+			"Exits non-zero if they differ.",
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(c *cobra.Command, args []string) error {
+			file := args[len(args)-1]
+			want, err := readDataFile(file)
+			if err != nil {
+				return err
+			}
+			ns, scope := parseArgs(c, args[:len(args)-1])
+			changes, err := newVars(ns, scope...).Diff(want)
+			if err != nil {
+				return err
+			}
+			if err := result(c, changes, func() { printChanges(c, changes) }); err != nil {
+				return err
+			}
+			if len(changes) > 0 {
+				return fmt.Errorf("vars differ from %s", file)
 			}
 			return nil
 		},
 	})
 
+	var applyDryRun bool
+	applyCmd := &cobra.Command{
+		Use:   "apply <name> [scope] <file>",
+		Short: "Make the vars for given name match a file",
+		Long: "Replace the vars for given name with the contents of a key=value or\n" +
+			"JSON file in a single write, printing each change as diff does.\n" +
+			"With --dry-run the changes are printed but not applied.",
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(c *cobra.Command, args []string) error {
+			want, err := readDataFile(args[len(args)-1])
+			if err != nil {
+				return err
+			}
+			ns, scope := parseArgs(c, args[:len(args)-1])
+			v := newVars(ns, scope...)
+			changes, err := v.Diff(want)
+			if err != nil {
+				return err
+			}
+			if !applyDryRun && len(changes) > 0 {
+				if err := v.Replace(want); err != nil {
+					return err
+				}
+			}
+			if err := result(c, changes, func() { printChanges(c, changes) }); err != nil {
+				return err
+			}
+			if applyDryRun {
+				info(c, fmt.Sprintf("Dry run: %d changes not applied", len(changes)))
+			} else {
+				info(c, fmt.Sprintf("Applied %d changes", len(changes)))
+			}
+			return nil
+		},
+	}
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "Print the changes without applying them")
+	cmd.AddCommand(applyCmd)
+
+	// parsePair splits the arguments of copy and move into a source and a
+	// destination. With four arguments both scopes are given; an empty
+	// string selects the namespace root.
+	parsePair := func(c *cobra.Command, args []string) (src, dst *vars.Vars, err error) {
+		if c.Flags().Changed("scope") {
+			return nil, nil, fmt.Errorf("--scope cannot be used with %s; give both scopes as arguments", c.Name())
+		}
+		open := func(args []string) *vars.Vars {
+			ns, scope := parseArgs(c, args)
+			return newVars(ns, scope...)
+		}
+		switch len(args) {
+		case 2:
+			src, dst = open(args[:1]), open(args[1:])
+		case 4:
+			src, dst = open(args[:2]), open(args[2:])
+		default:
+			return nil, nil, fmt.Errorf("expected <srcName> <dstName> or <srcName> <srcScope> <dstName> <dstScope>")
+		}
+		return src, dst, nil
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "copy <srcName> [srcScope] <dstName> [dstScope]",
+		Short: "Copy all vars from one name to another",
+		Long: "Copy all vars from one name to another, replacing the destination.\n" +
+			"Give both scopes or neither; use \"\" to select a namespace root.",
+		Args: cobra.RangeArgs(2, 4),
+		RunE: func(c *cobra.Command, args []string) error {
+			src, dst, err := parsePair(c, args)
+			if err != nil {
+				return err
+			}
+			if err := src.CopyTo(dst); err != nil {
+				return err
+			}
+			info(c, "Copied vars properties")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "move <srcName> [srcScope] <dstName> [dstScope]",
+		Short: "Move all vars from one name to another",
+		Long: "Move all vars from one name to another, replacing the destination\n" +
+			"and destroying the source. Give both scopes or neither; use \"\" to\n" +
+			"select a namespace root.",
+		Args: cobra.RangeArgs(2, 4),
+		RunE: func(c *cobra.Command, args []string) error {
+			src, dst, err := parsePair(c, args)
+			if err != nil {
+				return err
+			}
+			if err := src.CopyTo(dst); err != nil {
+				return err
+			}
+			if err := src.Destroy(); err != nil {
+				return err
+			}
+			info(c, "Moved vars properties")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "mv-ns <oldName> [oldScope] <newName> [newScope]",
+		Short: "Rename a name, or a scope, on disk",
+		Long: "Rename a name, including all of its scopes, or with four arguments\n" +
+			"a single scope. The destination must not already exist.",
+		Args: cobra.RangeArgs(2, 4),
+		RunE: func(c *cobra.Command, args []string) error {
+			src, dst, err := parsePair(c, args)
+			if err != nil {
+				return err
+			}
+			if err := src.RenameTo(dst); err != nil {
+				return err
+			}
+			info(c, "Renamed vars properties")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "tweak <name> [scope] <key>",
+		Short: "Change a single variable, prompting for the new value",
+		Long: "Print the current value of a variable and read a new one from stdin.\n" +
+			"An empty line keeps the current value. Without a terminal the new\n" +
+			"value is read from piped input.",
+		ValidArgsFunction: completeKeys,
+		Args:              cobra.RangeArgs(2, 3),
+		RunE: func(c *cobra.Command, args []string) error {
+			key := args[len(args)-1]
+			ns, scope := parseArgs(c, args[:len(args)-1])
+			v := newVars(ns, scope...)
+
+			current, _, err := v.Lookup(key)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(c.ErrOrStderr(), "%s [%s]: ", key, current)
+			line, err := bufio.NewReader(c.InOrStdin()).ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				return nil
+			}
+			return v.Set(key, line)
+		},
+	})
+
+	var maxValueSize int
+	validateCmd := &cobra.Command{
+		Use:   "validate <name> [scope]",
+		Short: "Check the vars file for problems without modifying it",
+		Long: "Check the vars file for malformed lines, duplicate keys, and values\n" +
+			"over --max-value-size, printing each problem and exiting non-zero\n" +
+			"if any are found.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			ns, scope := parseArgs(c, args)
+			v := newVars(ns, scope...).With(vars.WithMaxValueSize(maxValueSize))
+			problems, err := v.Validate()
+			if err != nil {
+				return err
+			}
+			if len(problems) == 0 {
+				info(c, "vars properties are valid")
+				return nil
+			}
+
+			reasons := make([]string, len(problems))
+			for i, p := range problems {
+				reasons[i] = p.Error()
+			}
+			if err := result(c, map[string][]string{"problems": reasons}, func() {
+				for _, r := range reasons {
+					c.Println(r)
+				}
+			}); err != nil {
+				return err
+			}
+			return fmt.Errorf("%d problem(s) found", len(problems))
+		},
+	}
+	validateCmd.Flags().IntVar(&maxValueSize, "max-value-size", 0, "Report values longer than this many bytes (0 for no limit)")
+	cmd.AddCommand(validateCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "fmt <name> [scope]",
+		Short: "Sort and deduplicate the vars file in place",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			ns, scope := parseArgs(c, args)
+			changed, err := newVars(ns, scope...).Compact()
+			if err != nil {
+				return err
+			}
+			if changed {
+				info(c, "Formatted vars properties")
+			} else {
+				info(c, "vars properties already formatted")
+			}
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "doctor <name> [scope]",
+		Short: "Report the status of the vars file for given name",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			ns, scope := parseArgs(c, args)
+			v := newVars(ns, scope...)
+			path, err := v.Path()
+			if err != nil {
+				return err
+			}
+
+			report := map[string]any{"path": path, "initialized": false}
+			lines := []string{"path:        " + path}
+
+			stat, err := os.Stat(path)
+			if os.IsNotExist(err) {
+				lines = append(lines, "initialized: false")
+				return result(c, report, func() {
+					c.Println(strings.Join(lines, "\n"))
+				})
+			}
+			if err != nil {
+				return err
+			}
+
+			data, err := v.All()
+			if err != nil {
+				return err
+			}
+			report["initialized"] = true
+			report["permissions"] = stat.Mode().Perm().String()
+			report["keys"] = len(data)
+			report["size"] = stat.Size()
+			report["modified"] = stat.ModTime().Format(time.RFC3339)
+			lines = append(lines,
+				"initialized: true",
+				"permissions: "+stat.Mode().Perm().String(),
+				fmt.Sprintf("keys:        %d", len(data)),
+				fmt.Sprintf("size:        %d bytes", stat.Size()),
+				"modified:    "+stat.ModTime().Format(time.RFC3339),
+			)
+			return result(c, report, func() {
+				c.Println(strings.Join(lines, "\n"))
+			})
+		},
+	})
+
+	var watchInterval time.Duration
+	watchCmd := &cobra.Command{
+		Use:   "watch <name> [scope]",
+		Short: "Print all vars for given name each time they change",
+		Long: "Print all vars for given name each time they change, until interrupted.\n" +
+			"Each block is followed by a blank line; with --output json each change\n" +
+			"is printed as one JSON object per line.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(c.Context(), os.Interrupt)
+			defer stop()
+
+			ns, scope := parseArgs(c, args)
+			changes, err := newVars(ns, scope...).Watch(ctx, watchInterval)
+			if err != nil {
+				return err
+			}
+			for data := range changes {
+				keys := make([]string, 0, len(data))
+				for k := range data {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+
+				err := result(c, data, func() {
+					for _, k := range keys {
+						c.Printf("%s=%s\n", k, data[k])
+					}
+					c.Println()
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	watchCmd.Flags().DurationVar(&watchInterval, "interval", time.Second, "How often to check for changes")
+	cmd.AddCommand(watchCmd)
+
+	var genPackage, genType string
+	genGoCmd := &cobra.Command{
+		Use:   "gen-go <name> [scope]",
+		Short: "Generate a Go struct and loader for the variables",
+		Long: "Print a Go source file declaring a struct with a field for each key,\n" +
+			"typed as bool, int, float64 or string from its current value, and a\n" +
+			"Load function reading it with the vars package.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			ns, scope := parseArgs(c, args)
+			data, err := newVars(ns, scope...).All()
+			if err != nil {
+				return err
+			}
+			src, err := genGo(genPackage, genType, ns, strings.Join(scope, ""), data)
+			if err != nil {
+				return err
+			}
+			c.Print(string(src))
+			return nil
+		},
+	}
+	genGoCmd.Flags().StringVar(&genPackage, "package", "config", "Package name of the generated file")
+	genGoCmd.Flags().StringVar(&genType, "type", "Config", "Name of the generated struct")
+	cmd.AddCommand(genGoCmd)
+
+	var logLimit int
+	logCmd := &cobra.Command{
+		Use:   "log <name> [scope]",
+		Short: "Print the recent changes to the variables, oldest first",
+		Long: fmt.Sprintf("Print the recent changes made through vars, oldest first. Changes are\n"+
+			"only recorded while %s=1 is set; the last %d are kept, with their old\n"+
+			"and new values in plain text beside the store, even after a key is unset.\n"+
+			"Edits made directly to the file are not recorded.", changeLogEnv, changeLogSize),
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			if !changeLogEnabled() {
+				return fmt.Errorf("the change log is off (set %s=1 to record changes)", changeLogEnv)
+			}
+			ns, scope := parseArgs(c, args)
+			entries, err := newVars(ns, scope...).ChangeLog()
+			if err != nil {
+				return err
+			}
+			if logLimit > 0 && len(entries) > logLimit {
+				entries = entries[len(entries)-logLimit:]
+			}
+			return result(c, entries, func() {
+				for _, e := range entries {
+					c.Printf("%s %s\n", e.Time.Format(time.RFC3339), changeLine(e.Change))
+				}
+			})
+		},
+	}
+	logCmd.Flags().IntVarP(&logLimit, "limit", "n", 0, "Only print the last n changes")
+	cmd.AddCommand(logCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "version",
+		Short: "Print the version of vars and the Go version it was built with",
+		Args:  cobra.NoArgs,
+		RunE: func(c *cobra.Command, args []string) error {
+			version, goVersion := buildVersion()
+			return result(c, map[string]string{"version": version, "go": goVersion}, func() {
+				c.Printf("vars %s (%s)\n", version, goVersion)
+			})
+		},
+	})
+
+	var destroyForce bool
+	destroyCmd := &cobra.Command{
+		Use:   "destroy <name> [scope]",
+		Short: "Delete the vars file for given name",
+		Long: "Delete the vars file for given name, and its directory if left empty.\n" +
+			"Asks for confirmation on stdin unless --force is given.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			ns, scope := parseArgs(c, args)
+			v := newVars(ns, scope...)
+			path, err := v.Path()
+			if err != nil {
+				return err
+			}
+
+			if !destroyForce {
+				if ok, err := confirm(c, "Delete "+path+"?"); err != nil || !ok {
+					return err
+				}
+			}
+
+			if err := v.Destroy(); err != nil {
+				return err
+			}
+			info(c, "Destroyed vars properties")
+			return nil
+		},
+	}
+	destroyCmd.Flags().BoolVarP(&destroyForce, "force", "f", false, "Delete without asking for confirmation")
+	destroyCmd.Flags().BoolVarP(&destroyForce, "yes", "y", false, "Alias for --force")
+	cmd.AddCommand(destroyCmd)
+
 	cmd.AddCommand(&cobra.Command{
 		Use:   "edit <name> [scope]",
 		Short: "Edit vars file in default editor",
 		Args:  cobra.RangeArgs(1, 2),
 		RunE: func(c *cobra.Command, args []string) error {
-			ns, scope := parseArgs(args)
-			return vars.New(ns, scope...).Edit()
+			ns, scope := parseArgs(c, args)
+			return newVars(ns, scope...).Edit()
 		},
 	})
 
 	cmd.AddCommand(&cobra.Command{
+		Use:   "cat <name> [scope]",
+		Short: "Prints the raw vars file for given name",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			ns, scope := parseArgs(c, args)
+			raw, err := newVars(ns, scope...).Raw()
+			if err != nil {
+				return err
+			}
+			return result(c, map[string]string{"raw": string(raw)}, func() {
+				c.Print(string(raw))
+			})
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "path <name> [scope]",
+		Short: "Print the path to the vars file for given name",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			ns, scope := parseArgs(c, args)
+			path, err := newVars(ns, scope...).Path()
+			if err != nil {
+				return err
+			}
+			return result(c, map[string]string{"path": path}, func() {
+				c.Println(path)
+			})
+		},
+	})
+
+	var keysGlob string
+	keysCmd := &cobra.Command{
 		Use:     "keys <name> [scope]",
 		Aliases: []string{"k"},
 		Short:   "List all keys for given vars name",
-		Args:    cobra.ExactArgs(1),
+		Args:    cobra.RangeArgs(1, 2),
 		RunE: func(c *cobra.Command, args []string) error {
-			ns, scope := parseArgs(args)
-			data, err := vars.New(ns, scope...).All()
+			ns, scope := parseArgs(c, args)
+			data, err := selectData(newVars(ns, scope...), keysGlob)
 			if err != nil {
 				return err
 			}
@@ -115,36 +831,194 @@ func cmd() *cobra.Command {
 			}
 			sort.Strings(keys)
 
-			for _, k := range keys {
-				c.Printf("%s\n", k)
+			return result(c, keys, func() {
+				for _, k := range keys {
+					c.Printf("%s\n", k)
+				}
+			})
+		},
+	}
+	keysCmd.Flags().StringVar(&keysGlob, "glob", "", "Only list keys matching the glob pattern")
+	cmd.AddCommand(keysCmd)
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "values <name> [scope]",
+		Short: "List all values for given vars name, in key order",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(c *cobra.Command, args []string) error {
+			ns, scope := parseArgs(c, args)
+			vals, err := newVars(ns, scope...).Values()
+			if err != nil {
+				return err
 			}
-			return nil
+			return result(c, vals, func() {
+				for _, val := range vals {
+					c.Println(val)
+				}
+			})
 		},
 	})
 
-	cmd.AddCommand(&cobra.Command{
-		Use:   "get <name> [scope] <key>",
-		Short: "Get a variable from a specific vars property value",
-		Args:  cobra.ExactArgs(2),
+	var getRaw bool
+	getCmd := &cobra.Command{
+		Use:               "get <name> [scope] <key>",
+		Short:             "Get a variable from a specific vars property value",
+		ValidArgsFunction: completeKeys,
+		Args:              cobra.RangeArgs(2, 3),
 		RunE: func(c *cobra.Command, args []string) error {
 			key := args[len(args)-1]
-			ns, scope := parseArgs(args[:len(args)-1])
-			val, err := vars.New(ns, scope...).Get(key)
+			ns, scope := parseArgs(c, args[:len(args)-1])
+			val, err := newVars(ns, scope...).Get(key)
 			if err != nil {
 				return err
 			}
-			c.Println(val)
-			return nil
+			return result(c, map[string]string{"key": key, "value": val}, func() {
+				if getRaw {
+					c.Print(val)
+					return
+				}
+				c.Println(val)
+			})
 		},
-	})
+	}
+	getCmd.Flags().BoolVarP(&getRaw, "raw", "n", false, "Print the value without a trailing newline")
+	cmd.AddCommand(getCmd)
 
 	return cmd
 }
 
-func parseArgs(contextArgs []string) (namespace string, scope []string) {
-	namespace = contextArgs[0]
+// changeLogSize is the number of changes kept for the log command.
+const changeLogSize = 100
+
+// changeLogEnv names the environment variable that turns on the change log
+// read by the log command. It is off by default because the log keeps old
+// and new values in plain text, even after a key is unset.
+const changeLogEnv = "VARS_CHANGE_LOG"
+
+func changeLogEnabled() bool {
+	on, _ := strconv.ParseBool(os.Getenv(changeLogEnv))
+	return on
+}
+
+// newVars opens a store with the settings shared by every command, such as
+// recording changes for the log command when it is enabled.
+func newVars(namespace string, scope ...string) *vars.Vars {
+	v := vars.New(namespace, scope...)
+	if changeLogEnabled() {
+		v.With(vars.WithChangeLog(changeLogSize))
+	}
+	return v
+}
+
+// parseArgs returns the namespace and scope selected by <name> [scope],
+// where the name may also be given as a combined name/scope. A combined
+// scope and a separate one are joined, as are further slashes, so that the
+// library rejects them as nested scopes.
+//
+// The --scope flag, when given, selects the scope instead, with a warning if
+// the arguments also named a different one.
+func parseArgs(c *cobra.Command, contextArgs []string) (namespace string, scope []string) {
+	namespace, scope = splitStore(contextArgs)
+	if c.Flags().Changed("scope") {
+		flag, _ := c.Flags().GetString("scope")
+		if len(scope) > 0 && scope[0] != flag {
+			c.PrintErrf("warning: --scope %q overrides the scope %q given as an argument\n", flag, scope[0])
+		}
+		scope = []string{flag}
+	}
+	return namespace, scope
+}
+
+func splitStore(contextArgs []string) (namespace string, scope []string) {
+	namespace, combined, ok := strings.Cut(contextArgs[0], "/")
+	var parts []string
+	if ok {
+		parts = append(parts, combined)
+	}
 	if len(contextArgs) > 1 {
-		scope = []string{contextArgs[1]}
+		parts = append(parts, contextArgs[1])
+	}
+	if len(parts) > 0 {
+		scope = []string{strings.Join(parts, "/")}
 	}
 	return namespace, scope
 }
+
+// completeKeys suggests existing keys for commands taking
+// <name> [scope] <key>. With only a name given, the keys of the namespace
+// root are offered, as the next argument may be a key or a scope.
+func completeKeys(c *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 || len(args) > 2 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	ns, scope := parseArgs(c, args)
+	data, err := newVars(ns, scope...).All()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, cobra.ShellCompDirectiveNoFileComp
+}
+
+// buildVersion returns the module version recorded by the Go toolchain,
+// which is set by "go install module@version", and the Go version. Builds
+// from a source checkout report "devel".
+func buildVersion() (version, goVersion string) {
+	version, goVersion = "devel", runtime.Version()
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version, goVersion
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		version = v
+	}
+	return version, info.GoVersion
+}
+
+// readDataFile reads variables from a JSON object of strings if the file
+// has a .json extension or its content begins with "{", and from the
+// key=value properties format otherwise.
+func readDataFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) == ".json" || strings.HasPrefix(strings.TrimSpace(string(b)), "{") {
+		var data map[string]string
+		if err := json.Unmarshal(b, &data); err != nil {
+			return nil, fmt.Errorf("invalid JSON in %s: %w", path, err)
+		}
+		return data, nil
+	}
+	return vars.Parse(bytes.NewReader(b))
+}
+
+// printChanges prints one line per change: "+ key=value" for an added key,
+// "~ key=old -> new" for a changed one and "- key=value" for a removed one.
+func printChanges(c *cobra.Command, changes []vars.Change) {
+	for _, ch := range changes {
+		c.Println(changeLine(ch))
+	}
+}
+
+// changeLine formats ch as "+ key=new", "~ key=old -> new" or "- key=old".
+func changeLine(ch vars.Change) string {
+	switch ch.Kind {
+	case vars.Added:
+		return fmt.Sprintf("+ %s=%s", ch.Key, ch.New)
+	case vars.Changed:
+		return fmt.Sprintf("~ %s=%s -> %s", ch.Key, ch.Old, ch.New)
+	}
+	return fmt.Sprintf("- %s=%s", ch.Key, ch.Old)
+}
+
+func selectData(v *vars.Vars, glob string) (map[string]string, error) {
+	if glob == "" {
+		return v.All()
+	}
+	return v.Match(glob)
+}
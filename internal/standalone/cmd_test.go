@@ -0,0 +1,901 @@
+package standalone
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func run(args ...string) (stdout, stderr string, code int) {
+	return runWithInput("", args...)
+}
+
+func runWithInput(input string, args ...string) (stdout, stderr string, code int) {
+	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
+	code = execute(context.Background(), args, strings.NewReader(input), out, errOut)
+	return out.String(), errOut.String(), code
+}
+
+func TestQuiet(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+
+	out, errOut, code := run("init", "-q", "quiet-app")
+	if code != 0 {
+		t.Fatalf("init -q failed: %s", errOut)
+	}
+	if out != "" {
+		t.Errorf("Expected no output with -q, got %q", out)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "quiet-app", "vars.properties")); err != nil {
+		t.Errorf("init -q did not create the file: %v", err)
+	}
+
+	if out, _, _ := run("init", "loud-app"); out == "" {
+		t.Error("Expected confirmation without -q")
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	run("init", "json-app")
+	run("set", "json-app", "theme", "dark")
+
+	out, _, code := run("get", "--output", "json", "json-app", "theme")
+	if code != 0 {
+		t.Fatalf("get failed with code %d", code)
+	}
+	var got map[string]string
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("get output is not JSON: %q", out)
+	}
+	if got["key"] != "theme" || got["value"] != "dark" {
+		t.Errorf("Unexpected get result: %v", got)
+	}
+
+	out, errOut, code := run("get", "-o", "json", "json-app", "missing")
+	if code == 0 {
+		t.Error("Expected non-zero exit for a missing key")
+	}
+	if out != "" {
+		t.Errorf("Expected no stdout on error, got %q", out)
+	}
+	var gotErr map[string]string
+	if err := json.Unmarshal([]byte(errOut), &gotErr); err != nil {
+		t.Fatalf("error output is not JSON: %q", errOut)
+	}
+	if gotErr["error"] == "" {
+		t.Errorf("Expected an error field, got %v", gotErr)
+	}
+
+	if _, _, code := run("get", "-o", "yaml", "json-app", "theme"); code == 0 {
+		t.Error("Expected failure for an unknown output format")
+	}
+}
+
+func TestCopyMove(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+
+	run("init", "src-app")
+	run("set", "src-app", "theme", "dark")
+
+	// --- copy: source remains ---
+	if _, errOut, code := run("copy", "src-app", "dst-app"); code != 0 {
+		t.Fatalf("copy failed: %s", errOut)
+	}
+	if out, _, _ := run("get", "dst-app", "theme"); out != "dark\n" {
+		t.Errorf("Copied value mismatch: %q", out)
+	}
+	if out, _, _ := run("get", "src-app", "theme"); out != "dark\n" {
+		t.Errorf("Source should remain after copy: %q", out)
+	}
+
+	// --- move: source is gone ---
+	if _, errOut, code := run("move", "src-app", "", "dst-app", "prod"); code != 0 {
+		t.Fatalf("move failed: %s", errOut)
+	}
+	if out, _, _ := run("get", "dst-app", "prod", "theme"); out != "dark\n" {
+		t.Errorf("Moved value mismatch: %q", out)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "src-app", "vars.properties")); !os.IsNotExist(err) {
+		t.Errorf("Source should be removed after move: %v", err)
+	}
+
+	// --- src == dst is refused ---
+	if _, _, code := run("copy", "dst-app", "dst-app"); code == 0 {
+		t.Error("copy onto itself should fail")
+	}
+	if _, _, code := run("copy", "dst-app", "prod", "dst-app"); code == 0 {
+		t.Error("copy with three arguments should fail")
+	}
+}
+
+func TestTweak(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	run("init", "tweak-app")
+	run("set", "tweak-app", "theme", "dark")
+
+	_, prompt, code := runWithInput("light\n", "tweak", "tweak-app", "theme")
+	if code != 0 {
+		t.Fatalf("tweak failed: %s", prompt)
+	}
+	if !strings.Contains(prompt, "theme [dark]") {
+		t.Errorf("Prompt should show the current value, got %q", prompt)
+	}
+	if out, _, _ := run("get", "tweak-app", "theme"); out != "light\n" {
+		t.Errorf("Expected tweaked value, got %q", out)
+	}
+
+	// An empty line keeps the current value.
+	runWithInput("\n", "tweak", "tweak-app", "theme")
+	if out, _, _ := run("get", "tweak-app", "theme"); out != "light\n" {
+		t.Errorf("Empty input should keep the value, got %q", out)
+	}
+
+	// Piped input without a trailing newline creates a new key.
+	runWithInput("en", "tweak", "tweak-app", "lang")
+	if out, _, _ := run("get", "tweak-app", "lang"); out != "en\n" {
+		t.Errorf("Expected new key from stdin, got %q", out)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+
+	run("init", "valid-app")
+	run("set", "valid-app", "theme", "dark")
+	if _, errOut, code := run("validate", "valid-app"); code != 0 {
+		t.Errorf("validate failed for a valid file: %s", errOut)
+	}
+
+	run("init", "broken-app")
+	fixture := "# broken fixture\ntheme=dark\nthemedark\ntheme=light\nbanner=" + strings.Repeat("x", 100) + "\n"
+	file := filepath.Join(tempDir, "broken-app", "vars.properties")
+	os.WriteFile(file, []byte(fixture), 0600)
+
+	out, _, code := run("validate", "--max-value-size", "64", "broken-app")
+	if code == 0 {
+		t.Error("Expected non-zero exit for a broken file")
+	}
+	for _, want := range []string{"line 3: malformed", "line 4: duplicate key \"theme\"", "line 5: value for \"banner\""} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in output:\n%s", want, out)
+		}
+	}
+
+	if got, _ := os.ReadFile(file); string(got) != fixture {
+		t.Error("validate modified the file")
+	}
+}
+
+func TestFmt(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+
+	run("init", "messy-app")
+	messy := "zeta=1\n\n# UI color scheme\ntheme=dark\nalpha=2\nzeta=3\n"
+	file := filepath.Join(tempDir, "messy-app", "vars.properties")
+	os.WriteFile(file, []byte(messy), 0600)
+
+	out, errOut, code := run("fmt", "messy-app")
+	if code != 0 {
+		t.Fatalf("fmt failed: %s", errOut)
+	}
+	if !strings.Contains(out, "Formatted") {
+		t.Errorf("Unexpected output: %q", out)
+	}
+
+	want := "alpha=2\n# UI color scheme\ntheme=dark\nzeta=3\n"
+	if got, _ := os.ReadFile(file); string(got) != want {
+		t.Errorf("Canonical output mismatch.\nWant: %q\nGot:  %q", want, got)
+	}
+
+	if out, _, _ := run("fmt", "messy-app"); !strings.Contains(out, "already formatted") {
+		t.Errorf("Expected already formatted, got %q", out)
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	path := filepath.Join(tempDir, "doctor-app", "vars.properties")
+
+	out, errOut, code := run("doctor", "doctor-app")
+	if code != 0 {
+		t.Fatalf("doctor failed for an uninitialized store: %s", errOut)
+	}
+	if !strings.Contains(out, "path:        "+path) || !strings.Contains(out, "initialized: false") {
+		t.Errorf("Unexpected uninitialized report:\n%s", out)
+	}
+
+	run("init", "doctor-app")
+	run("set", "doctor-app", "theme", "dark")
+	run("set", "doctor-app", "lang", "en")
+
+	out, _, _ = run("doctor", "doctor-app")
+	for _, want := range []string{"path:        " + path, "initialized: true", "keys:        2", "permissions: -rw-------"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in report:\n%s", want, out)
+		}
+	}
+}
+
+// syncBuffer is a bytes.Buffer that is safe to read while a command is
+// still writing to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestWatch(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "watch-app")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out, errOut := new(syncBuffer), new(syncBuffer)
+	done := make(chan int)
+	go func() {
+		done <- execute(ctx, []string{"watch", "--interval", "10ms", "watch-app"}, strings.NewReader(""), out, errOut)
+	}()
+
+	// The watcher may not have taken its first snapshot yet, so keep
+	// changing the store until an update is printed.
+	deadline := time.Now().Add(5 * time.Second)
+	for n := 0; !strings.Contains(out.String(), "theme=dark"); n++ {
+		if time.Now().After(deadline) {
+			t.Fatalf("watch printed no update, got %q (stderr %q)", out.String(), errOut.String())
+		}
+		run("set", "watch-app", "theme", "dark")
+		run("set", "watch-app", "count", strconv.Itoa(n))
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case code := <-done:
+		if code != 0 {
+			t.Errorf("watch exited with %d: %s", code, errOut.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not exit after cancellation")
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+
+	out, errOut, code := run("completion", "bash")
+	if code != 0 || out == "" {
+		t.Fatalf("completion bash failed (%d): %s", code, errOut)
+	}
+
+	run("init", "comp-app")
+	run("set", "comp-app", "theme", "dark")
+	run("set", "comp-app", "lang", "en")
+
+	// __complete is the hidden command the generated scripts call.
+	out, _, _ = run("__complete", "get", "comp-app", "")
+	if !strings.HasPrefix(out, "lang\ntheme\n") {
+		t.Errorf("expected key suggestions, got %q", out)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	out, errOut, code := run("version")
+	if code != 0 {
+		t.Fatalf("version failed: %s", errOut)
+	}
+	if !strings.HasPrefix(out, "vars ") || len(strings.TrimSpace(out)) <= len("vars") {
+		t.Errorf("unexpected version output %q", out)
+	}
+}
+
+func TestDataAll(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	os.Mkdir(filepath.Join(tempDir, "unrelated-app"), 0700)
+
+	run("init", "first-app")
+	run("set", "first-app", "theme", "dark")
+	run("init", "second-app", "ingest")
+	run("set", "second-app", "ingest", "url", "https://example.com")
+
+	out, errOut, code := run("data-all")
+	if code != 0 {
+		t.Fatalf("data-all failed: %s", errOut)
+	}
+	want := "[first-app]\ntheme=dark\n\n[second-app/ingest]\nurl=https://example.com\n\n"
+	if out != want {
+		t.Errorf("data-all output = %q, want %q", out, want)
+	}
+
+	out, _, _ = run("data-all", "-o", "json")
+	var all map[string]map[string]string
+	if err := json.Unmarshal([]byte(out), &all); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out, err)
+	}
+	if all["second-app/ingest"]["url"] != "https://example.com" || len(all) != 2 {
+		t.Errorf("unexpected JSON output %v", all)
+	}
+}
+
+func TestMset(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "mset-app")
+	run("init", "mset-app", "ingest")
+
+	out, errOut, code := run("mset", "mset-app", "theme=dark", "lang=en", "url=https://x.io/?a=b")
+	if code != 0 {
+		t.Fatalf("mset failed: %s", errOut)
+	}
+	if !strings.Contains(out, "Set 3 vars") {
+		t.Errorf("expected a count of 3, got %q", out)
+	}
+	out, _, _ = run("data", "mset-app")
+	if out != "lang=en\ntheme=dark\nurl=https://x.io/?a=b\n" {
+		t.Errorf("unexpected data after mset: %q", out)
+	}
+
+	run("mset", "mset-app", "ingest", "batch=10")
+	if out, _, _ := run("get", "mset-app", "ingest", "batch"); out != "10\n" {
+		t.Errorf("scoped mset: get = %q, want 10", out)
+	}
+
+	if _, _, code := run("mset", "mset-app", "theme=light", "oops"); code == 0 {
+		t.Error("expected mset to reject an argument without =")
+	}
+	if out, _, _ := run("get", "mset-app", "theme"); out != "dark\n" {
+		t.Errorf("rejected mset modified the store: theme = %q", out)
+	}
+}
+
+func TestDestroy(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	file := filepath.Join(tempDir, "doomed-app", "vars.properties")
+	run("init", "doomed-app")
+
+	// --- Case 1: Declining the prompt keeps the file ---
+	if _, errOut, code := runWithInput("n\n", "destroy", "doomed-app"); code != 0 || !strings.Contains(errOut, "[y/N]") {
+		t.Fatalf("destroy prompt failed (%d): %q", code, errOut)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Fatalf("declined destroy removed the file: %v", err)
+	}
+
+	// --- Case 2: --force deletes the file and the empty directory ---
+	if _, errOut, code := run("destroy", "--force", "doomed-app"); code != 0 {
+		t.Fatalf("destroy --force failed: %s", errOut)
+	}
+	if _, err := os.Stat(filepath.Dir(file)); !os.IsNotExist(err) {
+		t.Errorf("expected the namespace directory to be removed, got %v", err)
+	}
+
+	// --- Case 3: Confirming with y deletes a scoped store ---
+	run("init", "doomed-app", "ingest")
+	if _, errOut, code := runWithInput("y\n", "destroy", "doomed-app", "ingest"); code != 0 {
+		t.Fatalf("confirmed destroy failed: %s", errOut)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "doomed-app", "ingest")); !os.IsNotExist(err) {
+		t.Errorf("expected the scope directory to be removed, got %v", err)
+	}
+
+	// --- Case 4: A store reached through a symlink outside the state dir ---
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "vars.properties"), []byte("keep=me\n"), 0600)
+	if err := os.Symlink(outside, filepath.Join(tempDir, "linked-app")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	_, errOut, code := run("destroy", "--yes", "linked-app")
+	if code == 0 || !strings.Contains(errOut, "outside the state directory") {
+		t.Errorf("expected destroy to refuse, got %d: %q", code, errOut)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "vars.properties")); err != nil {
+		t.Errorf("file outside the state dir was removed: %v", err)
+	}
+}
+
+func TestSetEmptyKey(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "emptykey-app")
+
+	if _, errOut, code := run("set", "emptykey-app", "", "x"); code == 0 || !strings.Contains(errOut, "key cannot be empty") {
+		t.Errorf("set with an empty key = %d, %q", code, errOut)
+	}
+	if _, _, code := run("mset", "emptykey-app", "=x"); code == 0 {
+		t.Error("mset with an empty key should fail")
+	}
+	if out, _, _ := run("cat", "emptykey-app"); out != "" {
+		t.Errorf("expected an empty file, got %q", out)
+	}
+}
+
+func TestReset(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "reset-app")
+	run("mset", "reset-app", "theme=dark", "lang=en")
+
+	if _, errOut, code := run("reset", "reset-app", "theme"); code != 0 {
+		t.Fatalf("reset failed: %s", errOut)
+	}
+	if out, _, _ := run("data", "reset-app"); out != "lang=en\n" {
+		t.Errorf("data after reset = %q", out)
+	}
+
+	// --- Case 2: reset --all asks first, and declining keeps every key ---
+	for _, answer := range []string{"n\n", ""} {
+		if _, errOut, code := runWithInput(answer, "reset", "--all", "reset-app"); code != 0 || !strings.Contains(errOut, "[y/N]") {
+			t.Fatalf("reset --all declined = %d, %q; want a prompt and no error", code, errOut)
+		}
+		if out, _, _ := run("data", "reset-app"); out != "lang=en\n" {
+			t.Errorf("data after declining reset --all = %q, want it unchanged", out)
+		}
+	}
+	if _, errOut, code := runWithInput("y\n", "reset", "--all", "reset-app"); code != 0 {
+		t.Fatalf("reset --all failed: %s", errOut)
+	}
+	if out, _, _ := run("data", "reset-app"); out != "" {
+		t.Errorf("data after reset --all = %q, want empty", out)
+	}
+
+	run("set", "reset-app", "theme", "dark")
+	if _, errOut, code := run("reset", "--all", "--force", "reset-app"); code != 0 {
+		t.Fatalf("reset --all --force failed: %s", errOut)
+	}
+	if out, _, _ := run("data", "reset-app"); out != "" {
+		t.Errorf("data after reset --all --force = %q, want empty", out)
+	}
+	if _, _, code := run("reset", "reset-app"); code == 0 {
+		t.Error("reset without a key or --all should fail")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "diff-app")
+	run("mset", "diff-app", "theme=dark", "lang=en")
+
+	same := filepath.Join(tempDir, "same.properties")
+	os.WriteFile(same, []byte("lang=en\ntheme=dark\n"), 0600)
+	if out, errOut, code := run("diff", "diff-app", same); code != 0 || out != "" {
+		t.Errorf("diff of a matching file = %d, %q, %q", code, out, errOut)
+	}
+
+	other := filepath.Join(tempDir, "other.json")
+	os.WriteFile(other, []byte(`{"theme": "light", "url": "https://x.io"}`), 0600)
+	out, errOut, code := run("diff", "diff-app", other)
+	if code == 0 {
+		t.Error("diff of a differing file should exit non-zero")
+	}
+	want := "- lang=en\n~ theme=dark -> light\n+ url=https://x.io\n"
+	if out != want {
+		t.Errorf("diff output = %q, want %q", out, want)
+	}
+	if !strings.Contains(errOut, "differ") {
+		t.Errorf("expected a differ message on stderr, got %q", errOut)
+	}
+
+	out, _, _ = run("diff", "-o", "json", "diff-app", other)
+	if !strings.Contains(out, `{"key":"lang","kind":"removed","old":"en"}`) {
+		t.Errorf("unexpected JSON diff %q", out)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "apply-app")
+	run("mset", "apply-app", "theme=dark", "lang=en")
+
+	file := filepath.Join(tempDir, "desired.properties")
+	os.WriteFile(file, []byte("theme=light\nurl=https://x.io\n"), 0600)
+
+	// --- Case 1: --dry-run prints the changes and leaves the store ---
+	out, errOut, code := run("apply", "--dry-run", "apply-app", file)
+	if code != 0 {
+		t.Fatalf("apply --dry-run failed: %s", errOut)
+	}
+	if !strings.HasPrefix(out, "- lang=en\n~ theme=dark -> light\n+ url=https://x.io\n") || !strings.Contains(out, "Dry run: 3 changes") {
+		t.Errorf("unexpected dry run output %q", out)
+	}
+	if data, _, _ := run("data", "apply-app"); data != "lang=en\ntheme=dark\n" {
+		t.Errorf("dry run modified the store: %q", data)
+	}
+
+	// --- Case 2: apply makes the store match the file ---
+	out, errOut, code = run("apply", "apply-app", file)
+	if code != 0 {
+		t.Fatalf("apply failed: %s", errOut)
+	}
+	if !strings.Contains(out, "Applied 3 changes") {
+		t.Errorf("expected a summary, got %q", out)
+	}
+	if data, _, _ := run("data", "apply-app"); data != "theme=light\nurl=https://x.io\n" {
+		t.Errorf("store after apply = %q", data)
+	}
+	if _, _, code := run("diff", "apply-app", file); code != 0 {
+		t.Error("diff should report no differences after apply")
+	}
+}
+
+func TestMvNs(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "old-app")
+	run("set", "old-app", "theme", "dark")
+	run("init", "old-app", "ingest")
+	run("set", "old-app", "ingest", "batch", "10")
+
+	// --- Case 1: Renaming a namespace takes its scopes along ---
+	if _, errOut, code := run("mv-ns", "old-app", "new-app"); code != 0 {
+		t.Fatalf("mv-ns failed: %s", errOut)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "old-app")); !os.IsNotExist(err) {
+		t.Errorf("expected the old namespace to be gone, got %v", err)
+	}
+	if out, _, _ := run("get", "new-app", "theme"); out != "dark\n" {
+		t.Errorf("theme after rename = %q", out)
+	}
+	if out, _, _ := run("get", "new-app", "ingest", "batch"); out != "10\n" {
+		t.Errorf("scoped batch after rename = %q", out)
+	}
+
+	// --- Case 2: Renaming a scope ---
+	if _, errOut, code := run("mv-ns", "new-app", "ingest", "new-app", "import"); code != 0 {
+		t.Fatalf("mv-ns of a scope failed: %s", errOut)
+	}
+	if out, _, _ := run("get", "new-app", "import", "batch"); out != "10\n" {
+		t.Errorf("batch after scope rename = %q", out)
+	}
+
+	// --- Case 3: Existing destinations and traversal are refused ---
+	run("init", "taken-app")
+	if _, errOut, code := run("mv-ns", "new-app", "taken-app"); code == 0 || !strings.Contains(errOut, "already exists") {
+		t.Errorf("expected an existing destination to be refused, got %d: %q", code, errOut)
+	}
+	if _, _, code := run("mv-ns", "new-app", "../escaped"); code == 0 {
+		t.Error("expected a traversal in the new name to be refused")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(tempDir), "escaped")); !os.IsNotExist(err) {
+		t.Error("rename escaped the state directory")
+	}
+}
+
+func TestGetRaw(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "raw-app")
+	run("set", "raw-app", "theme", "dark")
+
+	if out, _, _ := run("get", "raw-app", "theme"); out != "dark\n" {
+		t.Errorf("get = %q, want a trailing newline", out)
+	}
+	for _, flag := range []string{"--raw", "-n"} {
+		if out, errOut, code := run("get", flag, "raw-app", "theme"); code != 0 || out != "dark" {
+			t.Errorf("get %s = %q (%d: %s), want %q", flag, out, code, errOut, "dark")
+		}
+	}
+}
+
+func TestSetComment(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "comment-app")
+
+	if _, errOut, code := run("set", "comment-app", "theme", "dark", "--comment", "UI color scheme"); code != 0 {
+		t.Fatalf("set --comment failed: %s", errOut)
+	}
+	got, _ := os.ReadFile(filepath.Join(tempDir, "comment-app", "vars.properties"))
+	if string(got) != "# UI color scheme\ntheme=dark\n" {
+		t.Errorf("file = %q, want the comment above the key", got)
+	}
+
+	// --- Case 2: An empty comment removes it ---
+	run("set", "comment-app", "theme", "light", "--comment", "")
+	if out, _, _ := run("cat", "comment-app"); out != "theme=light\n" {
+		t.Errorf("file after clearing the comment = %q", out)
+	}
+
+	if _, _, code := run("set", "--if-not-exists", "--comment", "x", "comment-app", "lang", "en"); code == 0 {
+		t.Error("expected --comment with --if-not-exists to be refused")
+	}
+}
+
+func TestSetType(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "type-app")
+
+	valid := []struct{ typ, in, want string }{
+		{"int", "3", "3"},
+		{"int", "007", "7"},
+		{"int", "-42", "-42"},
+		{"bool", "TRUE", "true"},
+		{"bool", "0", "false"},
+		{"float", "1.50", "1.5"},
+		{"float", "2", "2"},
+		{"duration", "90s", "1m30s"},
+		{"duration", "1h", "1h0m0s"},
+	}
+	for _, tc := range valid {
+		if _, errOut, code := run("set", "--type", tc.typ, "--", "type-app", "k", tc.in); code != 0 {
+			t.Errorf("set %s --type %s failed: %s", tc.in, tc.typ, errOut)
+			continue
+		}
+		if out, _, _ := run("get", "-n", "type-app", "k"); out != tc.want {
+			t.Errorf("set %s --type %s stored %q, want %q", tc.in, tc.typ, out, tc.want)
+		}
+	}
+
+	// --- Case 2: Invalid values are rejected and nothing is stored ---
+	run("set", "type-app", "k", "kept")
+	invalid := []struct{ typ, in string }{
+		{"int", "3x"},
+		{"int", "1.5"},
+		{"bool", "yes"},
+		{"float", "1,5"},
+		{"duration", "10"},
+		{"int", "99999999999999999999"},
+	}
+	for _, tc := range invalid {
+		_, errOut, code := run("set", "--type", tc.typ, "--", "type-app", "k", tc.in)
+		if code == 0 {
+			t.Errorf("expected set %s --type %s to fail", tc.in, tc.typ)
+		}
+		if want := fmt.Sprintf("invalid %s value %q", tc.typ, tc.in); !strings.Contains(errOut, want) {
+			t.Errorf("set %s --type %s error = %q, want it to contain %q", tc.in, tc.typ, errOut, want)
+		}
+	}
+	if _, errOut, _ := run("set", "type-app", "k", "99999999999999999999", "--type", "int"); !strings.Contains(errOut, "value out of range") {
+		t.Errorf("out-of-range error = %q, want the parse error included", errOut)
+	}
+	if out, _, _ := run("get", "-n", "type-app", "k"); out != "kept" {
+		t.Errorf("value after invalid sets = %q, want it unchanged", out)
+	}
+
+	// --- Case 3: An unknown type is rejected ---
+	if _, _, code := run("set", "type-app", "k", "1", "--type", "uint"); code == 0 {
+		t.Error("expected an unknown --type to be refused")
+	}
+
+	// --- Case 4: The canonical value is used with --comment ---
+	run("set", "type-app", "retries", "03", "--type", "int", "--comment", "Retry count")
+	if out, _, _ := run("cat", "type-app"); !strings.Contains(out, "# Retry count\nretries=3\n") {
+		t.Errorf("file = %q, want the canonical value under its comment", out)
+	}
+}
+
+func TestLog(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+
+	// --- Case 1: The log is off by default and keeps no values ---
+	run("init", "quiet-app")
+	run("set", "quiet-app", "api_token", "s3cret")
+	run("unset", "quiet-app", "api_token")
+	if _, err := os.Stat(filepath.Join(tempDir, "quiet-app", "vars.properties.log")); !os.IsNotExist(err) {
+		t.Errorf("expected no change log without %s, got %v", changeLogEnv, err)
+	}
+	if _, errOut, code := run("log", "quiet-app"); code == 0 || !strings.Contains(errOut, changeLogEnv) {
+		t.Errorf("log without %s = %d, %q; want an error naming it", changeLogEnv, code, errOut)
+	}
+
+	// --- Case 2: With the variable set, changes are recorded ---
+	t.Setenv(changeLogEnv, "1")
+	run("init", "log-app")
+	run("set", "log-app", "theme", "dark")
+	run("set", "log-app", "theme", "light")
+	run("set", "log-app", "lang", "en")
+	run("unset", "log-app", "theme")
+
+	out, errOut, code := run("log", "log-app")
+	if code != 0 {
+		t.Fatalf("log failed: %s", errOut)
+	}
+	var got []string
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		_, change, _ := strings.Cut(line, " ")
+		got = append(got, change)
+	}
+	want := []string{"+ theme=dark", "~ theme=dark -> light", "+ lang=en", "- theme=light"}
+	if !slices.Equal(got, want) {
+		t.Errorf("log = %q, want changes %q", out, want)
+	}
+
+	if out, _, _ := run("log", "-n", "1", "log-app"); !strings.HasSuffix(out, " - theme=light\n") || strings.Count(out, "\n") != 1 {
+		t.Errorf("log -n 1 = %q", out)
+	}
+}
+
+func TestCombinedScopeArg(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "combined-app")
+	run("init", "combined-app", "dev")
+	run("set", "combined-app", "theme", "root")
+	run("set", "combined-app", "dev", "theme", "dark")
+
+	if out, errOut, code := run("get", "combined-app/dev", "theme"); code != 0 || out != "dark\n" {
+		t.Errorf("get combined-app/dev theme = %q (%d: %s), want dark", out, code, errOut)
+	}
+	if _, errOut, code := run("set", "combined-app/dev", "lang", "en"); code != 0 {
+		t.Fatalf("set with a combined argument failed: %s", errOut)
+	}
+	if out, _, _ := run("get", "combined-app", "dev", "lang"); out != "en\n" {
+		t.Errorf("two-arg get after a combined set = %q, want en", out)
+	}
+	if out, _, _ := run("get", "combined-app", "theme"); out != "root\n" {
+		t.Errorf("namespace root theme = %q, want root", out)
+	}
+
+	// --- Case 2: Copy accepts combined source and destination ---
+	if _, errOut, code := run("copy", "combined-app/dev", "combined-app/staging"); code != 0 {
+		t.Fatalf("copy with combined arguments failed: %s", errOut)
+	}
+	if out, _, _ := run("get", "combined-app", "staging", "theme"); out != "dark\n" {
+		t.Errorf("copied theme = %q, want dark", out)
+	}
+
+	// --- Case 3: Malformed combined arguments are rejected ---
+	for _, args := range [][]string{
+		{"get", "combined-app/dev/extra", "theme"},
+		{"get", "/dev", "theme"},
+		{"get", "combined-app/dev", "dev", "theme"},
+		{"get", "combined-app/..", "theme"},
+	} {
+		if _, _, code := run(args...); code == 0 {
+			t.Errorf("expected %q to be rejected", args)
+		}
+	}
+}
+
+func TestScopeFlag(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "flag-app")
+	run("init", "--scope", "dev", "flag-app")
+
+	if _, errOut, code := run("set", "--scope", "dev", "flag-app", "theme", "dark"); code != 0 {
+		t.Fatalf("set --scope failed: %s", errOut)
+	}
+	if out, _, _ := run("get", "flag-app", "dev", "theme"); out != "dark\n" {
+		t.Errorf("positional get after set --scope = %q, want dark", out)
+	}
+	if out, errOut, code := run("get", "-s", "dev", "flag-app", "theme"); code != 0 || out != "dark\n" {
+		t.Errorf("get -s dev = %q (%d: %s), want dark", out, code, errOut)
+	}
+	if out, _, _ := run("data", "--scope", "dev", "flag-app"); out != "theme=dark\n" {
+		t.Errorf("data --scope dev = %q", out)
+	}
+	if out, _, _ := run("data", "flag-app"); out != "" {
+		t.Errorf("namespace root = %q, want empty", out)
+	}
+
+	// --- Case 2: The flag wins over a positional scope, with a warning ---
+	run("init", "flag-app", "prod")
+	run("set", "flag-app", "prod", "theme", "light")
+	out, errOut, code := run("get", "--scope", "prod", "flag-app", "dev", "theme")
+	if code != 0 || out != "light\n" {
+		t.Errorf("get --scope prod with positional dev = %q (%d), want light", out, code)
+	}
+	if !strings.Contains(errOut, "warning") || !strings.Contains(errOut, `"dev"`) {
+		t.Errorf("expected a warning naming the overridden scope, got %q", errOut)
+	}
+
+	// --- Case 3: An empty flag selects the namespace root ---
+	run("set", "flag-app/dev", "lang", "en")
+	if out, _, _ := run("data", "--scope", "", "flag-app/dev"); out != "" {
+		t.Errorf("data --scope \"\" = %q, want the empty root", out)
+	}
+
+	if _, _, code := run("copy", "--scope", "dev", "flag-app", "other-app"); code == 0 {
+		t.Error("expected --scope to be refused by copy")
+	}
+}
+
+func TestGenGo(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "gen-app", "dev")
+	run("mset", "gen-app", "dev", "db.host=localhost", "db_host=dup", "db.max-conns=10",
+		"ratio=0.5", "debug=true", "mode=0700", "1st=x", `quote"d=y`)
+
+	out, errOut, code := run("gen-go", "--package", "appconfig", "gen-app", "dev")
+	if code != 0 {
+		t.Fatalf("gen-go failed: %s", errOut)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "config.go", out, 0)
+	if err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, out)
+	}
+	if file.Name.Name != "appconfig" {
+		t.Errorf("package = %s, want appconfig", file.Name.Name)
+	}
+
+	fields := make(map[string]string)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if st, ok := n.(*ast.StructType); ok {
+			for _, f := range st.Fields.List {
+				tag, _ := strconv.Unquote(f.Tag.Value)
+				key := reflect.StructTag(tag).Get("vars")
+				fields[key] = f.Names[0].Name + " " + f.Type.(*ast.Ident).Name
+			}
+		}
+		return true
+	})
+	want := map[string]string{
+		"db.host":      "DbHost string",
+		"db_host":      "DbHost2 string",
+		"db.max-conns": "DbMaxConns int",
+		"ratio":        "Ratio float64",
+		"debug":        "Debug bool",
+		"mode":         "Mode string",
+		"1st":          "X1st string",
+		`quote"d`:      "QuoteD string",
+	}
+	if !maps.Equal(fields, want) {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+	if !strings.Contains(out, `vars.New("gen-app", "dev").Unmarshal(&c)`) {
+		t.Errorf("expected a loader for gen-app/dev, got:\n%s", out)
+	}
+
+	if _, _, code := run("gen-go", "--type", "config", "gen-app", "dev"); code == 0 {
+		t.Error("expected an unexported type name to be refused")
+	}
+}
+
+func TestValues(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	run("init", "values-app", "servers")
+	run("mset", "values-app", "servers", "c=10.0.0.3", "a=10.0.0.1", "b=10.0.0.2")
+
+	out, errOut, code := run("values", "values-app", "servers")
+	if code != 0 {
+		t.Fatalf("values failed: %s", errOut)
+	}
+	if out != "10.0.0.1\n10.0.0.2\n10.0.0.3\n" {
+		t.Errorf("values = %q, want them in sorted key order", out)
+	}
+	if out, _, _ := run("values", "-o", "json", "values-app/servers"); out != `["10.0.0.1","10.0.0.2","10.0.0.3"]`+"\n" {
+		t.Errorf("values -o json = %q", out)
+	}
+}
@@ -0,0 +1,122 @@
+package standalone
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// genGo renders a Go source file declaring a struct named typeName with a
+// `vars`-tagged field per key in data, and a Load function reading it with
+// [vars.Vars.Unmarshal] from the store of namespace and scope.
+func genGo(pkg, typeName, namespace, scope string, data map[string]string) ([]byte, error) {
+	if !token.IsIdentifier(pkg) {
+		return nil, fmt.Errorf("invalid package name %q", pkg)
+	}
+	if !token.IsIdentifier(typeName) || !token.IsExported(typeName) {
+		return nil, fmt.Errorf("invalid type name %q (want an exported identifier)", typeName)
+	}
+
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	store, args := namespace, strconv.Quote(namespace)
+	if scope != "" {
+		store += "/" + scope
+		args += ", " + strconv.Quote(scope)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by \"vars gen-go\" from %s; DO NOT EDIT.\n\n", store)
+	fmt.Fprintf(&buf, "package %s\n\nimport \"github.com/rwx-yxu/vars\"\n\n", pkg)
+	fmt.Fprintf(&buf, "// %s holds the variables of %s.\n", typeName, store)
+	fmt.Fprintf(&buf, "type %s struct {\n", typeName)
+	used := make(map[string]bool)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "\t%s %s %s\n", fieldName(k, used), goType(data[k]), fieldTag(k))
+	}
+	buf.WriteString("}\n\n")
+	fmt.Fprintf(&buf, "// Load reads a %s from the %s store.\n", typeName, store)
+	fmt.Fprintf(&buf, "func Load() (%s, error) {\n", typeName)
+	fmt.Fprintf(&buf, "\tvar c %s\n\terr := vars.New(%s).Unmarshal(&c)\n\treturn c, err\n}\n", typeName, args)
+
+	return format.Source(buf.Bytes())
+}
+
+// fieldName derives an exported Go identifier from key by joining its
+// letters and digits in title case, so that "db.max-conns" becomes
+// DbMaxConns. A name starting with a digit is prefixed with "X", and a
+// name already in used gets a numeric suffix.
+func fieldName(key string, used map[string]bool) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+		}
+		b.WriteRune(r)
+		upper = false
+	}
+	name := b.String()
+	if name == "" || !unicode.IsUpper([]rune(name)[0]) {
+		name = "X" + name
+	}
+
+	unique := name
+	for n := 2; used[unique]; n++ {
+		unique = name + strconv.Itoa(n)
+	}
+	used[unique] = true
+	return unique
+}
+
+// goType infers the field type for val: bool for "true" or "false", int
+// and float64 for decimal numbers, and string otherwise.
+func goType(val string) string {
+	switch {
+	case val == "true" || val == "false":
+		return "bool"
+	case isDecimal(val):
+		if _, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return "int"
+		}
+		if _, err := strconv.ParseFloat(val, 64); err == nil {
+			return "float64"
+		}
+	}
+	return "string"
+}
+
+// isDecimal reports whether s is written with only a sign, digits and a
+// decimal point, excluding forms such as "Inf", "NaN", "0x1p-2" or "1e6"
+// that strconv would also accept. Values with a leading zero, such as
+// "0700", are excluded too, as a number would not keep it.
+func isDecimal(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	if s == "" || s == "." || len(s) > 1 && s[0] == '0' && s[1] != '.' {
+		return false
+	}
+	return strings.Count(s, ".") <= 1 && strings.Trim(s, "0123456789.") == ""
+}
+
+// fieldTag returns the struct tag naming key, as a raw string unless key
+// contains a backquote.
+func fieldTag(key string) string {
+	tag := "vars:" + strconv.Quote(key)
+	if strings.Contains(tag, "`") {
+		return strconv.Quote(tag)
+	}
+	return "`" + tag + "`"
+}
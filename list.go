@@ -0,0 +1,100 @@
+package vars
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ListNamespaces returns the sorted names of every namespace in the state
+// directory that holds at least one initialized store, either at its root or
+// in a scope. Other directories, such as those of unrelated applications
+// sharing XDG_STATE_HOME, are skipped.
+func ListNamespaces() ([]string, error) {
+	dir, err := defaultStateDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() || !validName(e.Name()) {
+			continue
+		}
+		v := New(e.Name())
+		scopes, err := v.Scopes()
+		if err != nil {
+			return nil, err
+		}
+		if ok, _ := v.IsInitialized(); ok || len(scopes) > 0 {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
+
+// Scopes returns the sorted scopes of v's namespace that hold an initialized
+// store, ignoring v's own scope. The unscoped store is not included. Nested
+// scopes are found only with [WithNestedScopes], and are returned in
+// slash-delimited form; with [WithFlatLayout], scopes are read from the
+// properties files beneath the namespace directory.
+func (v *Vars) Scopes() ([]string, error) {
+	dir, err := v.sibling("").basePath()
+	if err != nil {
+		return nil, err
+	}
+
+	var scopes []string
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return fs.SkipAll
+			}
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." && (!v.nestedScopes && strings.Contains(rel, "/") || !validName(d.Name())) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		scoped := v.sibling("")
+		if v.flatLayout {
+			name, ok := strings.CutSuffix(rel, ".properties")
+			if !ok || name == "vars" {
+				return nil
+			}
+			scoped.scope = name
+		} else {
+			if d.Name() != "vars.properties" || rel == "vars.properties" {
+				return nil
+			}
+			scoped.scope = path.Dir(rel)
+		}
+		if scoped.validate() == nil {
+			scopes = append(scopes, scoped.scope)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(scopes)
+	return scopes, nil
+}
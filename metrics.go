@@ -0,0 +1,33 @@
+package vars
+
+import "time"
+
+// Metrics receives counters and timings from a [Vars] handle. Supply an
+// implementation with [WithMetrics] to export them, for example to
+// Prometheus, without this package depending on a metrics library.
+//
+// Embed [NopMetrics] to implement only the methods of interest.
+type Metrics interface {
+	IncrGet()
+	IncrSet()
+	IncrUnset()
+	ObserveLoadDuration(d time.Duration)
+	ObserveSaveDuration(d time.Duration)
+}
+
+// NopMetrics is a [Metrics] implementation that discards everything.
+// It is the default when no metrics are configured.
+type NopMetrics struct{}
+
+func (NopMetrics) IncrGet()                            {}
+func (NopMetrics) IncrSet()                            {}
+func (NopMetrics) IncrUnset()                          {}
+func (NopMetrics) ObserveLoadDuration(d time.Duration) {}
+func (NopMetrics) ObserveSaveDuration(d time.Duration) {}
+
+// WithMetrics reports operation counts and file I/O durations to m.
+func WithMetrics(m Metrics) Option {
+	return func(v *Vars) {
+		v.metrics = m
+	}
+}
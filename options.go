@@ -0,0 +1,364 @@
+package vars
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Option configures optional behaviour of a [Vars] handle.
+//
+// Options are applied with [Vars.With] and should be set before the handle
+// is shared between goroutines.
+type Option func(*Vars)
+
+// With applies the given options to v and returns v for chaining.
+//
+//	v := vars.New("my-app").With(vars.WithFileMode(0640))
+func (v *Vars) With(opts ...Option) *Vars {
+	for _, opt := range opts {
+		opt(v)
+	}
+	v.opts = append(v.opts, opts...)
+	return v
+}
+
+// WithDirMode sets the permissions used when creating the state directory.
+// The default is 0700.
+//
+// Modes granting access to others are rejected unless [WithWorldAccess] is
+// also given.
+func WithDirMode(mode os.FileMode) Option {
+	return func(v *Vars) {
+		v.dirMode = mode
+	}
+}
+
+// WithFileMode sets the permissions used when creating vars.properties.
+// The default is 0600.
+//
+// Modes granting access to others are rejected unless [WithWorldAccess] is
+// also given.
+func WithFileMode(mode os.FileMode) Option {
+	return func(v *Vars) {
+		v.fileMode = mode
+	}
+}
+
+// WithWorldAccess permits directory and file modes that grant access to
+// users outside the owner and group. Stores often hold secrets, so this
+// must be opted into explicitly.
+func WithWorldAccess() Option {
+	return func(v *Vars) {
+		v.worldAccess = true
+	}
+}
+
+// WithNestedScopes relaxes the strict single-level scope, allowing a
+// slash-delimited scope such as "env/region" to map onto nested directories
+// beneath the namespace. Each segment is validated individually and "." or
+// ".." segments are rejected.
+func WithNestedScopes() Option {
+	return func(v *Vars) {
+		v.nestedScopes = true
+	}
+}
+
+// WithOnChange registers fn to be called with the full contents of the store
+// after each successful write, such as [Vars.Set], [Vars.Unset] or
+// [Vars.Replace]. It is called synchronously once the lock has been released,
+// so fn may read from the store. Failed writes and writes that change
+// nothing do not call fn.
+func WithOnChange(fn func(data map[string]string)) Option {
+	return func(v *Vars) {
+		v.onChange = fn
+	}
+}
+
+// notify calls the [WithOnChange] callback, if any, with data.
+func (v *Vars) notify(data map[string]string) {
+	if v.onChange != nil {
+		v.onChange(data)
+	}
+}
+
+// WithFinalNewline sets whether the properties file ends with a newline.
+// When true, the last line is terminated and an empty store is written as a
+// single newline; when false, the last line is left unterminated and an empty
+// store is written as an empty file.
+//
+// By default every line is terminated and an empty store is an empty file.
+func WithFinalNewline(final bool) Option {
+	return func(v *Vars) {
+		v.finalNewline = &final
+	}
+}
+
+// WithFlatLayout stores a scoped store as a file named after its scope
+// directly beneath the namespace directory, such as
+// "my-app/ingest.properties", instead of in a directory of its own. The
+// unscoped store is unaffected, so "vars" cannot be used as a scope.
+func WithFlatLayout() Option {
+	return func(v *Vars) {
+		v.flatLayout = true
+	}
+}
+
+// WithNoLock disables the mutex that makes Vars safe for concurrent use,
+// saving its small cost in a short-lived, single-goroutine program that
+// performs one operation, such as a CLI invocation.
+//
+// DANGER: with WithNoLock, concurrent use of the same Vars from more than one
+// goroutine is a data race and can silently lose writes or corrupt the
+// properties file. Do not use it in servers, libraries, or anywhere more
+// than one goroutine may touch the store.
+func WithNoLock() Option {
+	return func(v *Vars) {
+		v.noLock = true
+	}
+}
+
+// WithLogger registers a hook that is called as the store is used, allowing
+// activity to be forwarded to an application's logs or metrics.
+//
+// The following events are emitted:
+//
+//   - "init": a new properties file was created.
+//   - "set", "unset": a key was written or removed.
+//   - "replace": the whole store was replaced by [Vars.Replace].
+//   - "reset": a key was restored by [Vars.Reset], or every key by
+//     [Vars.ResetAll], in which case there is no "key" field.
+//   - "rename": the store was moved by [Vars.RenameTo].
+//   - "load_error": the store could not be read.
+//   - "lock_contention": an operation had to wait for another to finish.
+//   - "lock_timeout": a lock was not acquired within the time set by
+//     [WithLockTimeout]; "error" wraps [ErrLockTimeout].
+//   - "retry": a transient failure is about to be retried, see [WithRetry];
+//     "error" holds the failure.
+//
+// Fields always include "namespace" and "scope", plus "key" and "error" where
+// relevant. Without a logger no events are built.
+func WithLogger(fn func(event string, fields map[string]any)) Option {
+	return func(v *Vars) {
+		v.logger = fn
+	}
+}
+
+func (v *Vars) emit(event, key string, err error) {
+	if v.logger == nil {
+		return
+	}
+	fields := map[string]any{
+		"namespace": v.namespace,
+		"scope":     v.scope,
+	}
+	if key != "" {
+		fields["key"] = key
+	}
+	if err != nil {
+		fields["error"] = err
+	}
+	v.logger(event, fields)
+}
+
+// WithCaseInsensitiveKeys lowercases keys on every read and write, so that
+// "Theme" and "theme" refer to the same variable. Keys are stored lowercased.
+//
+// Enabling this on an existing store containing keys that differ only by
+// case makes them collide; the next write fails with an error naming the
+// colliding keys until they are resolved.
+func WithCaseInsensitiveKeys() Option {
+	return func(v *Vars) {
+		v.foldCase = true
+	}
+}
+
+// WithKeyNormalizer applies fn to every key on read and write, so that keys
+// are stored in the form fn returns and any key normalizing to it refers to
+// the same variable. For example, fn might trim an application prefix or
+// replace spaces with dots. With [WithCaseInsensitiveKeys], fn runs before
+// keys are lowercased.
+//
+// As with case folding, existing keys that normalize onto the same key
+// collide, and the next write fails until they are resolved.
+func WithKeyNormalizer(fn func(string) string) Option {
+	return func(v *Vars) {
+		v.normalizeKey = fn
+	}
+}
+
+// WithKeyOrder orders keys with less instead of lexicographically, both in
+// vars.properties and wherever keys are listed in order, such as
+// [Vars.KeysWhere] and the data and keys commands of [NewCmd]. less reports
+// whether a sorts before b, as for [sort.Slice]; for example, a natural
+// sort places "item2" before "item10".
+func WithKeyOrder(less func(a, b string) bool) Option {
+	return func(v *Vars) {
+		v.keyLess = less
+	}
+}
+
+// WithSkipUnchanged makes writes such as [Vars.Set] leave vars.properties
+// untouched when they would not change any value or comment, so that
+// setting a key to its current value neither rewrites the file nor calls
+// the [WithOnChange] callback. Without it, every write saves the file, which
+// also normalizes any hand edits.
+func WithSkipUnchanged() Option {
+	return func(v *Vars) {
+		v.skipUnchanged = true
+	}
+}
+
+// WithLockTimeout makes operations fail with an error wrapping
+// [ErrLockTimeout] if the store's lock, shared by every [Vars] for the same
+// file in this process, cannot be acquired within d, instead of waiting
+// indefinitely behind a stuck holder. Zero, the default, waits indefinitely.
+func WithLockTimeout(d time.Duration) Option {
+	return func(v *Vars) {
+		v.lockTimeout = d
+	}
+}
+
+// WithScopeInheritsRoot makes a scoped store fall back to the namespace
+// root, the store with no scope, for keys it does not hold itself. Reads
+// such as [Vars.Get], [Vars.Has], [Vars.All], [Vars.Render],
+// [Vars.GetComment] and the snapshot of [Vars.Begin] see the merged view,
+// with the scope's values taking precedence; writes only ever change the
+// scope. A root that has not been initialized contributes nothing.
+//
+// The option has no effect on an unscoped store or with a custom backend.
+func WithScopeInheritsRoot() Option {
+	return func(v *Vars) {
+		v.inheritRoot = true
+	}
+}
+
+// WithTrimValues controls whether surrounding whitespace is trimmed from
+// values read from vars.properties. It is enabled by default, which allows
+// hand-edited lines such as "key = value"; disable it to preserve values
+// like "  padded  " exactly. Keys are always trimmed.
+func WithTrimValues(trim bool) Option {
+	return func(v *Vars) {
+		v.trimValues = trim
+	}
+}
+
+// WithAppendMode makes [Vars.Set] append new keys to the end of
+// vars.properties instead of rewriting the whole file. Updates to existing
+// keys still rewrite the file. The file is no longer kept sorted; call
+// [Vars.Compact] to tidy it.
+//
+// Append mode only applies to the default file backend.
+func WithAppendMode() Option {
+	return func(v *Vars) {
+		v.appendMode = true
+	}
+}
+
+// WithFsync makes every write flush vars.properties and its directory to
+// stable storage before returning, so that a successful [Vars.Set] survives
+// a crash. It trades write speed for durability.
+func WithFsync() Option {
+	return func(v *Vars) {
+		v.fsync = true
+	}
+}
+
+// WithDelimiter changes the separator between keys and values in
+// vars.properties from "=" to delim, for example ":" to read "key: value"
+// files. The delimiter must be a single non-whitespace character that cannot
+// appear in names, and cannot be "#" or "\"; an invalid delimiter is reported
+// by the first operation.
+func WithDelimiter(delim string) Option {
+	return func(v *Vars) {
+		v.delimiter = delim
+	}
+}
+
+func validDelimiter(d string) bool {
+	r, size := utf8.DecodeRuneInString(d)
+	if size == 0 || size != len(d) || r == utf8.RuneError {
+		return false
+	}
+	return !unicode.IsSpace(r) && !unicode.IsControl(r) && !validNameRegex.MatchString(d) && d != "#" && d != `\`
+}
+
+// WithStrictParse makes reading vars.properties fail on malformed lines,
+// such as a line without a delimiter or with an empty key, reporting the
+// line number and content. By default such lines are silently skipped, and
+// so are lost on the next write.
+func WithStrictParse() Option {
+	return func(v *Vars) {
+		v.strictParse = true
+	}
+}
+
+// WithAutoInit makes writes such as [Vars.Set] create the state directory
+// and properties file on demand, removing the need to call [Vars.Init]
+// first. Reads of a missing store still fail.
+func WithAutoInit() Option {
+	return func(v *Vars) {
+		v.autoInit = true
+	}
+}
+
+// key returns the form of k used for storage.
+func (v *Vars) key(k string) string {
+	if v.normalizeKey != nil {
+		k = v.normalizeKey(k)
+	}
+	if v.foldCase {
+		return strings.ToLower(k)
+	}
+	return k
+}
+
+// sortKeys sorts keys in the order set by [WithKeyOrder].
+func (v *Vars) sortKeys(keys []string) {
+	if v.keyLess == nil {
+		sort.Strings(keys)
+		return
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return v.keyLess(keys[i], keys[j])
+	})
+}
+
+// foldKeys rewrites the keys of m into their stored form, reporting an error
+// if two distinct keys fold onto the same one.
+func (v *Vars) foldKeys(m map[string]string) (map[string]string, error) {
+	if !v.foldCase && v.normalizeKey == nil {
+		return m, nil
+	}
+	folded := make(map[string]string, len(m))
+	seen := make(map[string]string, len(m))
+	var err error
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		fk := v.key(k)
+		if prev, ok := seen[fk]; ok && err == nil {
+			err = fmt.Errorf("keys %q and %q collide as %q", prev, k, fk)
+		}
+		seen[fk] = k
+		folded[fk] = m[k]
+	}
+	return folded, err
+}
+
+func (v *Vars) checkModes() error {
+	if v.worldAccess {
+		return nil
+	}
+	if v.dirMode.Perm()&0007 != 0 {
+		return fmt.Errorf("dir mode %#o grants world access (use WithWorldAccess)", v.dirMode.Perm())
+	}
+	if v.fileMode.Perm()&0007 != 0 {
+		return fmt.Errorf("file mode %#o grants world access (use WithWorldAccess)", v.fileMode.Perm())
+	}
+	return nil
+}
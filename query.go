@@ -0,0 +1,120 @@
+package vars
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Query returns the variables matching expr, a filter on keys and values
+// built from terms joined by AND and OR:
+//
+//	key=glob      the key matches the glob pattern, as for [Vars.Match]
+//	key~=substr   the key contains substr
+//	value=exact   the value is exactly exact
+//	value~=substr the value contains substr
+//
+// AND binds more tightly than OR, so "key~=db AND value=on OR key=debug"
+// matches keys containing "db" whose value is "on", and also the key
+// "debug". Terms are separated by spaces; quote an operand that contains
+// spaces, as in `value="hello world"`. The operators are case-insensitive.
+// A malformed expression returns an error naming the offending token.
+func (v *Vars) Query(expr string) (map[string]string, error) {
+	match, err := parseQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := v.All()
+	if err != nil {
+		return nil, err
+	}
+	for k, val := range m {
+		if !match(k, val) {
+			delete(m, k)
+		}
+	}
+	return m, nil
+}
+
+type predicate func(key, val string) bool
+
+// parseQuery compiles expr into a predicate, evaluated as an OR of groups
+// of terms joined by AND.
+func parseQuery(expr string) (predicate, error) {
+	words, err := splitWords(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("invalid query: empty expression")
+	}
+
+	var groups [][]predicate
+	var group []predicate
+	for i, w := range words {
+		if i%2 == 1 {
+			switch {
+			case strings.EqualFold(w, "OR"):
+				groups = append(groups, group)
+				group = nil
+			case !strings.EqualFold(w, "AND"):
+				return nil, fmt.Errorf("invalid query: expected AND or OR, got %q", w)
+			}
+			if i == len(words)-1 {
+				return nil, fmt.Errorf("invalid query: missing term after %q", w)
+			}
+			continue
+		}
+		p, err := parseTerm(w)
+		if err != nil {
+			return nil, err
+		}
+		group = append(group, p)
+	}
+	groups = append(groups, group)
+
+	return func(key, val string) bool {
+		for _, g := range groups {
+			if matchesAll(g, key, val) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func matchesAll(group []predicate, key, val string) bool {
+	for _, p := range group {
+		if !p(key, val) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseTerm(term string) (predicate, error) {
+	field, operand, ok := strings.Cut(term, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid query: term %q has no operator (want = or ~=)", term)
+	}
+	field, contains := strings.CutSuffix(field, "~")
+
+	switch {
+	case field == "key" && contains:
+		return func(key, _ string) bool { return strings.Contains(key, operand) }, nil
+	case field == "key":
+		if _, err := path.Match(operand, ""); err != nil {
+			return nil, fmt.Errorf("invalid query: invalid glob in %q: %w", term, err)
+		}
+		return func(key, _ string) bool {
+			ok, _ := path.Match(operand, key)
+			return ok
+		}, nil
+	case field == "value" && contains:
+		return func(_, val string) bool { return strings.Contains(val, operand) }, nil
+	case field == "value":
+		return func(_, val string) bool { return val == operand }, nil
+	}
+	return nil, fmt.Errorf("invalid query: unknown field in %q (want key or value)", term)
+}
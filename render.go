@@ -0,0 +1,82 @@
+package vars
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var refRegex = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// WithKeepUnresolved makes [Vars.Render] leave references to missing keys
+// in place, such as "${missing}", instead of returning an error.
+func WithKeepUnresolved() Option {
+	return func(v *Vars) {
+		v.keepUnresolved = true
+	}
+}
+
+// Render returns the value of key with every "${other}" reference replaced
+// by the rendered value of the key named other.
+//
+// References may be nested to any depth. A reference cycle returns an error
+// naming the keys involved. A reference to a missing key is an error unless
+// [WithKeepUnresolved] is set.
+func (v *Vars) Render(key string) (string, error) {
+	if err := v.rlock(); err != nil {
+		return "", err
+	}
+	defer v.runlock()
+
+	m, err := v.view()
+	if err != nil {
+		return "", err
+	}
+	key = v.key(key)
+	if _, ok := m[key]; !ok {
+		return "", fmt.Errorf("key not found: %s", key)
+	}
+
+	r := renderer{v: v, data: m, done: make(map[string]string)}
+	return r.render(key, nil)
+}
+
+type renderer struct {
+	v    *Vars
+	data map[string]string
+	done map[string]string
+}
+
+func (r *renderer) render(key string, stack []string) (string, error) {
+	if val, ok := r.done[key]; ok {
+		return val, nil
+	}
+	if i := slices.Index(stack, key); i >= 0 {
+		cycle := slices.Concat(stack[i:], []string{key})
+		return "", fmt.Errorf("reference cycle: %s", strings.Join(cycle, " -> "))
+	}
+	stack = append(stack, key)
+
+	var err error
+	val := refRegex.ReplaceAllStringFunc(r.data[key], func(ref string) string {
+		if err != nil {
+			return ref
+		}
+		name := r.v.key(refRegex.FindStringSubmatch(ref)[1])
+		if _, ok := r.data[name]; !ok {
+			if !r.v.keepUnresolved {
+				err = fmt.Errorf("unresolved reference %s in %q", ref, key)
+			}
+			return ref
+		}
+		var out string
+		out, err = r.render(name, stack)
+		return out
+	})
+	if err != nil {
+		return "", err
+	}
+	r.done[key] = val
+	return val, nil
+}
@@ -0,0 +1,44 @@
+package vars
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// WithRetry retries loads and saves that fail with a transient error, such
+// as EAGAIN or a stale NFS handle, up to attempts times in total. The delay
+// starts at backoff and doubles after each failed attempt. Other errors,
+// including validation errors and an uninitialized store, fail immediately.
+//
+// By default each load and save is attempted once.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(v *Vars) {
+		v.retryAttempts = attempts
+		v.retryBackoff = backoff
+	}
+}
+
+// retry calls fn until it succeeds, fails with an error that is not
+// transient, or the attempts configured by [WithRetry] are used up.
+func (v *Vars) retry(fn func() error) error {
+	delay := v.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= v.retryAttempts || !transient(err) {
+			return err
+		}
+		v.emit("retry", "", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// transient reports whether err is likely to succeed if retried.
+func transient(err error) bool {
+	var t interface{ Temporary() bool }
+	if errors.As(err, &t) && t.Temporary() {
+		return true
+	}
+	return errors.Is(err, syscall.ESTALE) || errors.Is(err, syscall.EBUSY)
+}
@@ -0,0 +1,179 @@
+package vars
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// Unmarshal copies stored variables into the fields of the struct pointed
+// to by dst, using `vars:"key"` field tags to name the keys:
+//
+//	type Config struct {
+//		Theme   string        `vars:"theme"`
+//		Retries int           `vars:"retries"`
+//		Timeout time.Duration `vars:"timeout"`
+//	}
+//
+// Supported field types are string, bool, the integer and float kinds, and
+// [time.Duration]. Untagged fields and keys without a matching field are
+// ignored; fields whose key is missing are left unchanged.
+func (v *Vars) Unmarshal(dst any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("unmarshal target must be a non-nil pointer to a struct, got %T", dst)
+	}
+	rv = rv.Elem()
+
+	m, err := v.All()
+	if err != nil {
+		return err
+	}
+
+	for _, f := range structFields(rv.Type()) {
+		val, ok := m[v.key(f.key)]
+		if !ok {
+			continue
+		}
+		if err := setField(rv.Field(f.index), val); err != nil {
+			return fmt.Errorf("key %q: %w", f.key, err)
+		}
+	}
+	return nil
+}
+
+// Marshal stores the `vars`-tagged fields of the struct src, or a pointer to
+// one, in a single save. It is the inverse of [Vars.Unmarshal] and accepts
+// the same field types. Fields tagged with the omitempty option, as in
+// `vars:"theme,omitempty"`, are skipped when they hold the zero value.
+func (v *Vars) Marshal(src any) error {
+	rv := reflect.ValueOf(src)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("marshal source must be a struct or pointer to a struct, got %T", src)
+	}
+
+	values := make(map[string]string)
+	for _, f := range structFields(rv.Type()) {
+		fv := rv.Field(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		val, err := formatField(fv)
+		if err != nil {
+			return fmt.Errorf("key %q: %w", f.key, err)
+		}
+		values[v.key(f.key)] = val
+	}
+
+	err := v.update(func(m map[string]string) error {
+		maps.Copy(m, values)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for k := range values {
+		v.emit("set", k, nil)
+	}
+	return nil
+}
+
+type structField struct {
+	index     int
+	key       string
+	omitEmpty bool
+}
+
+// structFields returns the exported fields of t carrying a vars tag.
+func structFields(t reflect.Type) []structField {
+	var fields []structField
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("vars")
+		if !ok || tag == "-" || !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			continue
+		}
+		fields = append(fields, structField{
+			index:     i,
+			key:       name,
+			omitEmpty: opts == "omitempty",
+		})
+	}
+	return fields
+}
+
+func formatField(f reflect.Value) (string, error) {
+	if f.Type() == durationType {
+		return time.Duration(f.Int()).String(), nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		return f.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(f.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(f.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(f.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(f.Float(), 'g', -1, f.Type().Bits()), nil
+	default:
+		return "", fmt.Errorf("unsupported field type %s", f.Type())
+	}
+}
+
+func setField(f reflect.Value, val string) error {
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(val, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
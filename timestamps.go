@@ -0,0 +1,134 @@
+package vars
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// WithClock replaces [time.Now] as the source of the current time, such as
+// for the timestamps recorded by [WithKeyTimestamps].
+func WithClock(now func() time.Time) Option {
+	return func(v *Vars) {
+		v.now = now
+	}
+}
+
+// WithKeyTimestamps records when each key was last added or changed, so that
+// [Vars.ModifiedSince] can report recent changes. The times are kept in a
+// sidecar file next to the properties file, named after it with a ".times"
+// suffix.
+//
+// Only changes made through Vars are recorded; edits made directly to the
+// file, such as with [Vars.Edit], are not. Key timestamps are not supported
+// by custom backends.
+func WithKeyTimestamps() Option {
+	return func(v *Vars) {
+		v.keyTimes = true
+	}
+}
+
+// ModifiedSince returns the sorted keys that were last added or changed
+// after t. It requires [WithKeyTimestamps]; keys written before that option
+// was enabled have no timestamp and are never returned.
+func (v *Vars) ModifiedSince(t time.Time) ([]string, error) {
+	if !v.keyTimes {
+		return nil, fmt.Errorf("key timestamps are not enabled (see WithKeyTimestamps)")
+	}
+	if v.backend != nil {
+		return nil, fmt.Errorf("key timestamps are not supported by a custom backend")
+	}
+
+	if err := v.rlock(); err != nil {
+		return nil, err
+	}
+	defer v.runlock()
+
+	times, err := v.loadTimes()
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for k, ts := range times {
+		if ts.After(t) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (v *Vars) timesFile() string {
+	return v.fileName() + ".times"
+}
+
+// loadTimes reads the sidecar file. A missing file holds no timestamps.
+func (v *Vars) loadTimes() (map[string]time.Time, error) {
+	root, err := v.root()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	f, err := root.Open(v.timesFile())
+	if os.IsNotExist(err) {
+		return map[string]time.Time{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	raw, _, err := v.decode(f)
+	if err != nil {
+		return nil, err
+	}
+	times := make(map[string]time.Time, len(raw))
+	for k, s := range raw {
+		ts, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q for key %q in %s", s, k, v.timesFile())
+		}
+		times[k] = ts
+	}
+	return times, nil
+}
+
+// touchKeys updates the sidecar file after a write that changed before into
+// after: keys that were added or changed are stamped with the current time
+// and keys that were removed are forgotten.
+func (v *Vars) touchKeys(before, after map[string]string) error {
+	if !v.keyTimes || v.backend != nil {
+		return nil
+	}
+	times, err := v.loadTimes()
+	if err != nil {
+		return err
+	}
+
+	now := v.now()
+	for k, val := range after {
+		if old, ok := before[k]; !ok || old != val {
+			times[k] = now
+		}
+	}
+	raw := make(map[string]string, len(times))
+	for k, ts := range times {
+		if _, ok := after[k]; ok {
+			raw[k] = ts.Format(time.RFC3339Nano)
+		}
+	}
+
+	content, err := v.encode(raw, nil)
+	if err != nil {
+		return err
+	}
+	root, err := v.root()
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	return writeFileMode(root, v.timesFile(), content, v.fileMode)
+}
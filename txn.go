@@ -0,0 +1,114 @@
+package vars
+
+import (
+	"fmt"
+	"maps"
+)
+
+// Txn groups several reads and writes against a [Vars] store into a single
+// load and a single save.
+//
+// A Txn reads from a snapshot taken by [Vars.Begin] and buffers writes in
+// memory. [Txn.Commit] applies the buffered writes to the current contents
+// of the store under one write lock; [Txn.Rollback] discards them. Until then
+// the file is left untouched.
+//
+// A Txn is not safe for concurrent use.
+type Txn struct {
+	v       *Vars
+	data    map[string]string
+	changes map[string]*string
+	done    bool
+}
+
+// Begin starts a transaction by loading a snapshot of the store.
+func (v *Vars) Begin() (*Txn, error) {
+	if err := v.rlock(); err != nil {
+		return nil, err
+	}
+	defer v.runlock()
+
+	m, err := v.view()
+	if err != nil {
+		return nil, err
+	}
+	return &Txn{
+		v:       v,
+		data:    m,
+		changes: make(map[string]*string),
+	}, nil
+}
+
+// Get returns the value for key as seen by the transaction, including any
+// uncommitted writes.
+func (t *Txn) Get(key string) (string, error) {
+	if t.done {
+		return "", fmt.Errorf("transaction already finished")
+	}
+	val, ok := t.data[t.v.key(key)]
+	if !ok {
+		return "", fmt.Errorf("key not found: %s", key)
+	}
+	return val, nil
+}
+
+// Set buffers a write of val to key. A key that cannot be stored is
+// rejected here, as by [Vars.Set].
+func (t *Txn) Set(key, val string) error {
+	if t.done {
+		return fmt.Errorf("transaction already finished")
+	}
+	if err := t.v.checkKey(key); err != nil {
+		return err
+	}
+	key = t.v.key(key)
+	t.data[key] = val
+	t.changes[key] = &val
+	return nil
+}
+
+// Unset buffers the removal of key.
+func (t *Txn) Unset(key string) error {
+	if t.done {
+		return fmt.Errorf("transaction already finished")
+	}
+	key = t.v.key(key)
+	delete(t.data, key)
+	t.changes[key] = nil
+	return nil
+}
+
+// All returns a copy of all variables as seen by the transaction.
+func (t *Txn) All() (map[string]string, error) {
+	if t.done {
+		return nil, fmt.Errorf("transaction already finished")
+	}
+	return maps.Clone(t.data), nil
+}
+
+// Commit writes all buffered changes in a single save and ends the
+// transaction. Keys not touched by the transaction keep their current
+// values, even if they changed after [Vars.Begin].
+func (t *Txn) Commit() error {
+	if t.done {
+		return fmt.Errorf("transaction already finished")
+	}
+	t.done = true
+
+	return t.v.update(func(m map[string]string) error {
+		for k, val := range t.changes {
+			if val == nil {
+				delete(m, k)
+			} else {
+				m[k] = *val
+			}
+		}
+		return nil
+	})
+}
+
+// Rollback discards all buffered changes and ends the transaction.
+// It is safe to call after Commit.
+func (t *Txn) Rollback() {
+	t.done = true
+}
@@ -0,0 +1,191 @@
+package vars
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// binaryPrefix marks values written by [Vars.SetBytes].
+const binaryPrefix = "base64:"
+
+// SetBytes stores b under key, base64-encoding it so that arbitrary bytes
+// survive the text properties format. Read it back with [Vars.GetBytes].
+func (v *Vars) SetBytes(key string, b []byte) error {
+	return v.Set(key, binaryPrefix+base64.StdEncoding.EncodeToString(b))
+}
+
+// GetBytes returns the bytes stored under key by [Vars.SetBytes].
+//
+// It returns an error if the value was not written by SetBytes.
+func (v *Vars) GetBytes(key string) ([]byte, error) {
+	val, err := v.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	enc, ok := strings.CutPrefix(val, binaryPrefix)
+	if !ok {
+		return nil, fmt.Errorf("key %q does not hold binary data", key)
+	}
+	b, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid binary data for key %q: %w", key, err)
+	}
+	return b, nil
+}
+
+// SetInt stores n under key in decimal form.
+func (v *Vars) SetInt(key string, n int) error {
+	return v.Set(key, strconv.Itoa(n))
+}
+
+// GetInt parses the value stored under key as a decimal integer.
+func (v *Vars) GetInt(key string) (int, error) {
+	val, err := v.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid int %q for key %q: %w", val, key, err)
+	}
+	return n, nil
+}
+
+// SetBool stores b under key as "true" or "false".
+func (v *Vars) SetBool(key string, b bool) error {
+	return v.Set(key, strconv.FormatBool(b))
+}
+
+// GetBool parses the value stored under key with [strconv.ParseBool],
+// accepting values such as "true", "FALSE" or "1".
+func (v *Vars) GetBool(key string) (bool, error) {
+	val, err := v.Get(key)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("invalid bool %q for key %q: %w", val, key, err)
+	}
+	return b, nil
+}
+
+// SetFloat stores f under key in the shortest form that reads back as the
+// same number, such as "1.5".
+func (v *Vars) SetFloat(key string, f float64) error {
+	return v.Set(key, formatFloat(f))
+}
+
+// GetFloat parses the value stored under key as a 64-bit floating-point
+// number.
+func (v *Vars) GetFloat(key string) (float64, error) {
+	val, err := v.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid float %q for key %q: %w", val, key, err)
+	}
+	return f, nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// CanonicalValue parses val as a value of kind, one of "int", "bool",
+// "float" or "duration", and returns it in the form stored by the matching
+// setter, such as [Vars.SetInt]: "007" becomes "7", "TRUE" becomes "true"
+// and "90s" becomes "1m30s". A parse error is wrapped.
+func CanonicalValue(kind, val string) (string, error) {
+	var canonical string
+	var err error
+	switch kind {
+	case "int":
+		var n int
+		n, err = strconv.Atoi(val)
+		canonical = strconv.Itoa(n)
+	case "bool":
+		var b bool
+		b, err = strconv.ParseBool(val)
+		canonical = strconv.FormatBool(b)
+	case "float":
+		var f float64
+		f, err = strconv.ParseFloat(val, 64)
+		canonical = formatFloat(f)
+	case "duration":
+		var d time.Duration
+		d, err = time.ParseDuration(val)
+		canonical = d.String()
+	default:
+		return "", fmt.Errorf("unknown value type %q (want int, bool, float or duration)", kind)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid %s value %q: %w", kind, val, err)
+	}
+	return canonical, nil
+}
+
+// SetDuration stores d under key in the form produced by
+// [time.Duration.String], such as "25m0s".
+func (v *Vars) SetDuration(key string, d time.Duration) error {
+	return v.Set(key, d.String())
+}
+
+// GetDuration parses the value stored under key with [time.ParseDuration],
+// accepting values such as "25m" or "1h30m".
+func (v *Vars) GetDuration(key string) (time.Duration, error) {
+	val, err := v.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q for key %q", val, key)
+	}
+	return d, nil
+}
+
+// SetJSON stores src under key as compact JSON, for small structured values
+// such as a list or an object.
+func (v *Vars) SetJSON(key string, src any) error {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return fmt.Errorf("unable to encode key %q as JSON: %w", key, err)
+	}
+	return v.Set(key, string(b))
+}
+
+// GetJSON decodes the JSON value stored under key into dst, as with
+// [json.Unmarshal].
+func (v *Vars) GetJSON(key string, dst any) error {
+	val, err := v.Get(key)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(val), dst); err != nil {
+		return fmt.Errorf("invalid JSON for key %q: %w", key, err)
+	}
+	return nil
+}
+
+// GetAs fetches the value stored under key and converts it with parse, for
+// types the package does not handle itself, such as a URL or an enum. A
+// parse error is wrapped with the key.
+func GetAs[T any](v *Vars, key string, parse func(string) (T, error)) (T, error) {
+	var zero T
+	val, err := v.Get(key)
+	if err != nil {
+		return zero, err
+	}
+	t, err := parse(val)
+	if err != nil {
+		return zero, fmt.Errorf("invalid value for key %q: %w", key, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,40 @@
+//go:build unix
+
+package vars
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestModesIgnoreUmask(t *testing.T) {
+	old := syscall.Umask(0077)
+	defer syscall.Umask(old)
+
+	v := New("umask-app", "ingest").With(WithDirMode(0750), WithFileMode(0640), WithKeyTimestamps())
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	if err := v.Init(); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	v.Set("theme", "dark")
+
+	for path, want := range map[string]os.FileMode{
+		filepath.Join(tempDir, "umask-app"):                                    0750,
+		filepath.Join(tempDir, "umask-app", "ingest"):                          0750,
+		filepath.Join(tempDir, "umask-app", "ingest", "vars.properties"):       0640,
+		filepath.Join(tempDir, "umask-app", "ingest", "vars.properties.times"): 0640,
+	} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s has mode %#o, want %#o", path, got, want)
+		}
+	}
+}
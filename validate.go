@@ -0,0 +1,120 @@
+package vars
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+)
+
+// LineError describes a problem found on a single line of input.
+type LineError struct {
+	Line   int
+	Reason string
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// WithMaxValueSize sets the longest value, in bytes, that [Vars.Validate]
+// accepts. Zero, the default, means no limit.
+func WithMaxValueSize(n int) Option {
+	return func(v *Vars) {
+		v.maxValueSize = n
+	}
+}
+
+// Validate checks vars.properties without modifying it, returning every
+// malformed line, duplicated key, and value longer than [WithMaxValueSize].
+// An empty result means the file is valid. The error is reserved for
+// failures to read the file.
+func (v *Vars) Validate() ([]LineError, error) {
+	raw, err := v.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []LineError
+	seen := make(map[string]int)
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		key, val, ok := v.splitLine(line)
+		if !ok || key == "" {
+			problems = append(problems, LineError{n, fmt.Sprintf("malformed line %q", line)})
+			continue
+		}
+		if first, dup := seen[key]; dup {
+			problems = append(problems, LineError{n, fmt.Sprintf("duplicate key %q (first on line %d)", key, first)})
+		} else {
+			seen[key] = n
+		}
+		if v.maxValueSize > 0 && len(val) > v.maxValueSize {
+			problems = append(problems, LineError{n, fmt.Sprintf("value for %q is %d bytes (limit %d)", key, len(val), v.maxValueSize)})
+		}
+	}
+	return problems, scanner.Err()
+}
+
+// ImportReport reads lines in the properties format from r and stores every
+// valid pair in a single save, reporting each line it could not apply
+// instead of stopping at the first. Comments and blank lines are skipped, and
+// when a key appears more than once the last occurrence wins. applied is the
+// number of valid lines.
+//
+// The error is reserved for failures to read r or to save the store; nothing
+// is stored when it is set.
+func (v *Vars) ImportReport(r io.Reader) (applied int, errs []LineError, err error) {
+	pairs := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		key, val, ok := v.splitLine(line)
+		if !ok {
+			errs = append(errs, LineError{n, fmt.Sprintf("malformed line %q", line)})
+			continue
+		}
+		if err := v.checkKey(key); err != nil {
+			errs = append(errs, LineError{n, err.Error()})
+			continue
+		}
+		pairs[key] = val
+		applied++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, errs, err
+	}
+	if len(pairs) == 0 {
+		return 0, errs, nil
+	}
+
+	pairs, err = v.foldKeys(pairs)
+	if err != nil {
+		return 0, errs, err
+	}
+	v.metrics.IncrSet()
+	err = v.update(func(m map[string]string) error {
+		maps.Copy(m, pairs)
+		return nil
+	})
+	if err != nil {
+		return 0, errs, err
+	}
+	for k := range pairs {
+		v.emit("set", k, nil)
+	}
+	return applied, errs, nil
+}
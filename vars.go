@@ -6,16 +6,22 @@
 package vars
 
 import (
-	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
-	"sort"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 )
 
 // Vars provides thread-safe access to persistent vars properties.
@@ -27,11 +33,64 @@ type Vars struct {
 	namespace string
 	scope     string
 	mu        sync.RWMutex
+	noLock    bool
+	sharedMu  *sync.RWMutex
+	muOnce    sync.Once
 	stateDir  func() (string, error)
+	opts      []Option
+
+	dirMode     os.FileMode
+	fileMode    os.FileMode
+	worldAccess bool
+
+	nestedScopes bool
+	flatLayout   bool
+	foldCase     bool
+	normalizeKey func(string) string
+	trimValues   bool
+	appendMode   bool
+	fsync        bool
+	delimiter    string
+	strictParse  bool
+	finalNewline *bool
+	maxValueSize int
+	autoInit     bool
+
+	retryAttempts int
+	retryBackoff  time.Duration
+
+	keepUnresolved bool
+	fileRefDir     string
+	keyTimes       bool
+	changeLog      int
+	audit          io.Writer
+	backups        int
+	keyLess        func(a, b string) bool
+	skipUnchanged  bool
+	lockTimeout    time.Duration
+	inheritRoot    bool
+	envMirror      string
+	strictExpand   bool
+
+	defaults        map[string]string
+	defaultFallback bool
+
+	now func() time.Time
+
+	logger   func(event string, fields map[string]any)
+	onChange func(data map[string]string)
+	metrics  Metrics
+	backend  Backend
 }
 
 var validNameRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
 
+// validName reports whether s is safe to use as a single path segment.
+// The dot segments are rejected explicitly as validNameRegex allows them.
+func validName(s string) bool {
+	return validNameRegex.MatchString(s) && s != "." && s != ".."
+}
+
 func defaultStateDir() (string, error) {
 	if xdg := os.Getenv("XDG_STATE_HOME"); xdg != "" {
 		return xdg, nil
@@ -68,41 +127,216 @@ func New(ns string, scope ...string) *Vars {
 		namespace: ns,
 		scope:     s,
 		stateDir:  defaultStateDir,
+		dirMode:   0700,
+		fileMode:  0600,
+		metrics:   NopMetrics{},
+		now:       time.Now,
+
+		trimValues: true,
+		delimiter:  "=",
+	}
+}
+
+// NewValidated is like [New] but validates the namespace and scope
+// immediately, returning an error instead of deferring validation to the
+// first operation. Providing more than one scope returns an error rather
+// than panicking.
+func NewValidated(ns string, scope ...string) (*Vars, error) {
+	if len(scope) > 1 {
+		return nil, fmt.Errorf("vars: strict mode allows only a single level of scope (no nesting)")
+	}
+	v := New(ns, scope...)
+	if err := v.validate(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Default returns a handle for the given namespace and scope that has
+// already been initialized, collapsing the common New and [Vars.Init]
+// sequence. Names are validated as by [NewValidated].
+func Default(ns string, scope ...string) (*Vars, error) {
+	v, err := NewValidated(ns, scope...)
+	if err != nil {
+		return nil, err
 	}
+	if err := v.Init(); err != nil {
+		return nil, err
+	}
+	return v, nil
 }
 
 // Init ensures that the underlying storage directory and properties file exist.
 //
 // Init must be called before performing any [Vars.Set] or [Vars.Edit] operations.
-// It is safe to call Init multiple times.
+// It is safe to call Init multiple times. With a custom [Backend], Init only
+// validates the namespace and scope.
 func (v *Vars) Init() error {
+	_, err := v.InitIfNeeded()
+	return err
+}
+
+// InitIfNeeded behaves like [Vars.Init] but also reports whether a new, empty
+// properties file was created. It returns false if the file already existed.
+//
+// Existing data is never modified.
+func (v *Vars) InitIfNeeded() (bool, error) {
+	if v.backend != nil {
+		return false, v.validate()
+	}
 
 	path, err := v.basePath()
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if err := os.MkdirAll(path, 0700); err != nil {
-		return fmt.Errorf("failed to create state dir: %w", err)
+	if err := v.checkModes(); err != nil {
+		return false, err
+	}
+
+	if err := v.mkdirAll(path); err != nil {
+		return false, fmt.Errorf("failed to create state dir: %w", err)
 	}
 
 	root, err := os.OpenRoot(path)
 	if err != nil {
-		return fmt.Errorf("failed to open root: %w", err)
+		return false, fmt.Errorf("failed to open root: %w", err)
 	}
 
 	defer root.Close()
 
-	f, err := root.OpenFile("vars.properties", os.O_RDONLY|os.O_CREATE, 0600)
+	f, err := createFile(root, v.fileName(), v.fileMode)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create file: %w", err)
+	}
+
+	defer f.Close()
+
+	v.emit("init", "", nil)
+	return true, nil
+}
+
+// createFile creates name within root with exactly mode, regardless of the
+// umask. It fails with an error satisfying [os.IsExist] if name exists.
+func createFile(root *os.Root, name string, mode os.FileMode) (*os.File, error) {
+	f, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return nil, err
+	}
+	// The umask may have removed bits from the requested mode.
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return nil, err
 	}
+	return f, nil
+}
 
+// writeFileMode is like [os.Root.WriteFile], but a file it creates is given
+// exactly mode, as by createFile. An existing file keeps its mode.
+func writeFileMode(root *os.Root, name string, data []byte, mode os.FileMode) error {
+	f, err := createFile(root, name, mode)
+	if os.IsExist(err) {
+		return root.WriteFile(name, data, mode)
+	}
+	if err != nil {
+		return err
+	}
 	defer f.Close()
 
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// mkdirAll is like [os.MkdirAll] with the configured dir mode, but also sets
+// that mode exactly on each directory it creates, regardless of the umask.
+// Directories that already exist are left alone.
+func (v *Vars) mkdirAll(path string) error {
+	var missing []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		missing = append(missing, dir)
+	}
+	if err := os.MkdirAll(path, v.dirMode); err != nil {
+		return err
+	}
+	for _, dir := range missing {
+		if err := os.Chmod(dir, v.dirMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitWithSeed initializes the store like [Vars.Init] and, only if a new
+// properties file was created, fills it with seed. An existing store is
+// never modified, so seed supplies starting values for a fresh install.
+// With a custom [Backend] no file is created, so the seed is not written.
+func (v *Vars) InitWithSeed(seed map[string]string) error {
+	for k := range seed {
+		if err := v.checkKey(k); err != nil {
+			return err
+		}
+	}
+	seed, err := v.foldKeys(seed)
+	if err != nil {
+		return err
+	}
+
+	if err := v.lock(); err != nil {
+		return err
+	}
+	created, err := v.InitIfNeeded()
+	if err == nil && created {
+		if err = v.save(seed, nil); err == nil {
+			err = v.recordWrite(nil, seed)
+		}
+	}
+	v.unlock()
+	if err != nil || !created {
+		return err
+	}
+	v.notify(maps.Clone(seed))
+	return nil
+}
+
+// InitForce initializes the store like [Vars.Init] but truncates any existing
+// properties file, discarding all stored variables.
+func (v *Vars) InitForce() error {
+	if err := v.initForce(); err != nil {
+		return err
+	}
+	v.notify(map[string]string{})
 	return nil
 }
 
+func (v *Vars) initForce() error {
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	if _, err := v.InitIfNeeded(); err != nil {
+		return err
+	}
+	var before map[string]string
+	if v.tracksChanges() {
+		// A file that cannot be read is discarded without recording what
+		// it held.
+		before, _ = v.load()
+	}
+	if err := v.save(map[string]string{}, nil); err != nil {
+		return err
+	}
+	return v.recordWrite(before, map[string]string{})
+}
+
 func (v *Vars) root() (*os.Root, error) {
 	path, err := v.basePath()
 	if err != nil {
@@ -124,194 +358,1299 @@ func (v *Vars) root() (*os.Root, error) {
 
 }
 
-func (v *Vars) basePath() (string, error) {
+func (v *Vars) validate() error {
 	if v.namespace == "" {
-		return "", fmt.Errorf("namespace cannot be empty")
+		return fmt.Errorf("namespace cannot be empty")
 	}
 
-	if !validNameRegex.MatchString(v.namespace) {
-		return "", fmt.Errorf("invalid namespace %q", v.namespace)
+	if !validName(v.namespace) {
+		return fmt.Errorf("invalid namespace %q", v.namespace)
 	}
 
 	if v.scope != "" {
-		if strings.ContainsAny(v.scope, `/\`) {
-			return "", fmt.Errorf("invalid scope %q: nesting is not allowed", v.scope)
+		segments := []string{v.scope}
+		if v.nestedScopes {
+			segments = strings.Split(v.scope, "/")
+		} else if strings.ContainsAny(v.scope, `/\`) {
+			return fmt.Errorf("invalid scope %q: nesting is not allowed", v.scope)
+		}
+		for _, seg := range segments {
+			if !validName(seg) {
+				return fmt.Errorf("invalid scope %q", v.scope)
+			}
 		}
-		if !validNameRegex.MatchString(v.scope) {
-			return "", fmt.Errorf("invalid scope %q", v.scope)
+		if v.flatLayout && segments[len(segments)-1] == "vars" {
+			return fmt.Errorf("scope %q is reserved by the flat layout", v.scope)
 		}
 	}
 
+	if !validDelimiter(v.delimiter) {
+		return fmt.Errorf("invalid delimiter %q", v.delimiter)
+	}
+	return nil
+}
+
+func (v *Vars) basePath() (string, error) {
+	if err := v.validate(); err != nil {
+		return "", err
+	}
+
 	rootDir, err := v.stateDir()
 	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(rootDir, v.namespace, v.scope), nil
+	dir := v.scope
+	if v.flatLayout {
+		dir = path.Dir(v.scope)
+	}
+	return filepath.Join(rootDir, v.namespace, filepath.FromSlash(dir)), nil
+}
+
+// fileName returns the name of the properties file within basePath. It is
+// vars.properties unless [WithFlatLayout] names the file after the scope.
+func (v *Vars) fileName() string {
+	if v.flatLayout && v.scope != "" {
+		return path.Base(v.scope) + ".properties"
+	}
+	return "vars.properties"
+}
+
+// Path returns the absolute path to the properties file.
+//
+// The namespace and scope are validated, but the file itself is not required
+// to exist, so Path may be called before [Vars.Init].
+func (v *Vars) Path() (string, error) {
+	path, err := v.basePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(filepath.Join(path, v.fileName()))
+}
+
+// IsInitialized reports whether [Vars.Init] has created the properties file.
+//
+// A missing file is reported as false with a nil error; an error is returned
+// only for an invalid namespace or scope, or if the file cannot be inspected.
+// A store with a custom [Backend] is always considered initialized.
+func (v *Vars) IsInitialized() (bool, error) {
+	if v.backend != nil {
+		return true, v.validate()
+	}
+	path, err := v.Path()
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Scope returns a new Vars for the given scope of v's namespace, with the
+// same state directory and options as v. v must be unscoped and scope must
+// be a single valid level, so that nesting is rejected; registered defaults
+// are not carried over.
+//
+// Scope is not supported by custom backends, which hold a single store.
+func (v *Vars) Scope(scope string) (*Vars, error) {
+	if v.backend != nil {
+		return nil, fmt.Errorf("scopes are not supported by a custom backend")
+	}
+	if v.scope != "" {
+		return nil, fmt.Errorf("invalid scope %q: %s is already scoped and nesting is not allowed", scope, v.namespace+"/"+v.scope)
+	}
+	if scope == "" {
+		return nil, fmt.Errorf("scope cannot be empty")
+	}
+	if strings.ContainsAny(scope, `/\`) {
+		return nil, fmt.Errorf("invalid scope %q: nesting is not allowed", scope)
+	}
+	s := v.sibling(scope)
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
 // Get returns the value associated with the given key.
 //
 // It returns an error if vars has not been initialized (see [Vars.Init])
-// or if the key does not exist.
+// or if the key does not exist. With [WithFileRefs], a "@file:" value is
+// replaced by the contents of the file it names.
 func (v *Vars) Get(key string) (string, error) {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
+	if err := v.rlock(); err != nil {
+		return "", err
+	}
+	defer v.runlock()
+	v.metrics.IncrGet()
 
-	m, err := v.load()
+	m, err := v.view()
 	if err != nil {
 		return "", err
 	}
-	val, ok := m[key]
+	val, ok := m[v.key(key)]
+	if !ok && v.defaultFallback {
+		val, ok = v.defaults[v.key(key)]
+	}
 	if !ok {
 		return "", fmt.Errorf("key not found: %s", key)
 	}
-	return val, nil
+	return v.resolveFileRef(val)
 }
 
-// Set stores the value for the given key, overwriting it if it already exists.
-//
-// Changes are persisted to disk immediately. Returns an error if vars
-// has not been initialized.
-func (v *Vars) Set(key, val string) error {
-	v.mu.Lock()
-	defer v.mu.Unlock()
+// GetOr returns the value associated with the given key like [Vars.Get],
+// or fallback if the value cannot be returned for any reason, including a
+// missing key or a store that cannot be loaded.
+func (v *Vars) GetOr(key, fallback string) string {
+	val, err := v.Get(key)
+	if err != nil {
+		return fallback
+	}
+	return val
+}
 
-	m, err := v.load()
-	if err != nil && !os.IsNotExist(err) {
-		return err
+// Lookup returns the value associated with the given key and whether it
+// exists, mirroring a map lookup. A missing key is not an error; an error is
+// returned only if the store cannot be loaded, or if a file reference cannot
+// be resolved (see [WithFileRefs]).
+func (v *Vars) Lookup(key string) (string, bool, error) {
+	if err := v.rlock(); err != nil {
+		return "", false, err
+	}
+	defer v.runlock()
+	v.metrics.IncrGet()
+
+	m, err := v.view()
+	if err != nil {
+		return "", false, err
+	}
+	val, ok := m[v.key(key)]
+	if !ok {
+		return "", false, nil
+	}
+	val, err = v.resolveFileRef(val)
+	if err != nil {
+		return "", false, err
 	}
-	if m == nil {
-		m = make(map[string]string)
+	return val, true, nil
+}
+
+// GetMany loads the store once and returns the values of the requested keys
+// that exist, along with the requested keys that do not, in the order given.
+func (v *Vars) GetMany(keys ...string) (map[string]string, []string, error) {
+	if err := v.rlock(); err != nil {
+		return nil, nil, err
 	}
+	defer v.runlock()
+	v.metrics.IncrGet()
 
-	m[key] = val
-	return v.save(m)
+	m, err := v.view()
+	if err != nil {
+		return nil, nil, err
+	}
+	found := make(map[string]string, len(keys))
+	var missing []string
+	for _, key := range keys {
+		if val, ok := m[v.key(key)]; ok {
+			if found[key], err = v.resolveFileRef(val); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return found, missing, nil
 }
 
-// Unset removes the specified key and its value from vars.properties.
+// Equals reports whether key1 and key2 hold identical values, loading the
+// store once. Unlike [Vars.Equal], which compares two stores, it compares
+// two keys of the same store.
 //
-// If the key does not exist, Unset returns nil.
-func (v *Vars) Unset(key string) error {
-	v.mu.Lock()
-	defer v.mu.Unlock()
+// It returns an error if either key does not exist.
+func (v *Vars) Equals(key1, key2 string) (bool, error) {
+	if err := v.rlock(); err != nil {
+		return false, err
+	}
+	defer v.runlock()
+	v.metrics.IncrGet()
 
-	m, err := v.load()
+	m, err := v.view()
 	if err != nil {
-		return err
+		return false, err
+	}
+	val1, ok := m[v.key(key1)]
+	if !ok {
+		return false, fmt.Errorf("key not found: %s", key1)
+	}
+	val2, ok := m[v.key(key2)]
+	if !ok {
+		return false, fmt.Errorf("key not found: %s", key2)
 	}
-	delete(m, key)
-	return v.save(m)
+	return val1 == val2, nil
 }
 
-// All returns a copy of all stored variables as a map.
-func (v *Vars) All() (map[string]string, error) {
-	v.mu.RLock()
-	defer v.mu.RUnlock()
-	return v.load()
+// Has reports whether the given key exists.
+//
+// It returns an error if vars has not been initialized (see [Vars.Init]).
+func (v *Vars) Has(key string) (bool, error) {
+	if err := v.rlock(); err != nil {
+		return false, err
+	}
+	defer v.runlock()
+
+	m, err := v.view()
+	if err != nil {
+		return false, err
+	}
+	_, ok := m[v.key(key)]
+	return ok, nil
 }
 
-// Edit opens the properties file in the user's preferred editor.
-//
-// It resolves the editor in the following order:
-//  1. The "VISUAL" environment variable.
-//  2. The "EDITOR" environment variable.
-//  3. A fallback to "vi".
+// Set stores the value for the given key, overwriting it if it already exists.
 //
-// This method blocks until the editor process completes.
-func (v *Vars) Edit() error {
-	path, err := v.basePath()
+// Changes are persisted to disk immediately. Returns an error if vars
+// has not been initialized.
+func (v *Vars) Set(key, val string) error {
+	v.metrics.IncrSet()
+	if err := v.checkKey(key); err != nil {
+		return err
+	}
+
+	key = v.key(key)
+	err := v.update(func(m map[string]string) error {
+		if _, exists := m[key]; !exists && v.appendMode {
+			if a, ok := v.store().(appender); ok {
+				if err := a.Append(key, val); err != nil {
+					return err
+				}
+				m[key] = val
+				return errWritten
+			}
+		}
+		m[key] = val
+		return nil
+	})
 	if err != nil {
 		return err
 	}
+	v.emit("set", key, nil)
+	return nil
+}
 
-	filePath := filepath.Join(path, "vars.properties")
+// SetMany stores every key and value in pairs with a single save. Keys not
+// in pairs are left unchanged. Every key is checked before anything is
+// written, so either all pairs are stored or none are.
+func (v *Vars) SetMany(pairs map[string]string) error {
+	v.metrics.IncrSet()
 
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("vars not initialized for %q (run 'init' first)", v.namespace)
+	for k := range pairs {
+		if err := v.checkKey(k); err != nil {
+			return err
+		}
 	}
-
-	editor := os.Getenv("VISUAL")
-	if editor == "" {
-		editor = os.Getenv("EDITOR")
+	pairs, err := v.foldKeys(pairs)
+	if err != nil {
+		return err
 	}
-	if editor == "" {
-		editor = "vi"
+	err = v.update(func(m map[string]string) error {
+		maps.Copy(m, pairs)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	for k := range pairs {
+		v.emit("set", k, nil)
+	}
+	return nil
+}
 
-	parts := strings.Fields(editor)
-	executable := parts[0]
-	args := parts[1:]
-	args = append(args, filePath)
-
-	cmd := exec.Command(executable, args...)
-
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	return cmd.Run()
+// SetIfAbsent stores the value for the given key only if the key does not
+// already exist, reporting whether it was written. The check and the write
+// happen under a single lock, so exactly one of several concurrent callers
+// for the same key succeeds.
+func (v *Vars) SetIfAbsent(key, val string) (bool, error) {
+	key = v.key(key)
+	written := false
+	err := v.update(func(m map[string]string) error {
+		if _, exists := m[key]; exists {
+			return errUnchanged
+		}
+		m[key] = val
+		written = true
+		return nil
+	})
+	if err != nil || !written {
+		return false, err
+	}
+	v.metrics.IncrSet()
+	v.emit("set", key, nil)
+	return true, nil
 }
 
-func (v *Vars) load() (map[string]string, error) {
-	data := make(map[string]string)
+// Replace discards the current contents of the store and saves data in its
+// place in a single write. Keys missing from data are removed, along with
+// their comments. Every key is checked before anything is written.
+func (v *Vars) Replace(data map[string]string) error {
+	v.metrics.IncrSet()
 
-	root, err := v.root()
+	for k := range data {
+		if err := v.checkKey(k); err != nil {
+			return err
+		}
+	}
+	data, err := v.foldKeys(data)
 	if err != nil {
-		return nil, fmt.Errorf("unable to construct vars.properties path: %w", err)
+		return err
 	}
-
-	file, err := root.Open("vars.properties")
-	if os.IsNotExist(err) {
-		return data, fmt.Errorf("vars has not been initialized")
+	err = v.update(func(m map[string]string) error {
+		clear(m)
+		maps.Copy(m, data)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	v.emit("replace", "", nil)
+	return nil
+}
+
+// Unset removes the specified key and its value from vars.properties.
+//
+// If the key does not exist, Unset returns nil.
+func (v *Vars) Unset(key string) error {
+	v.metrics.IncrUnset()
+
+	key = v.key(key)
+	err := v.update(func(m map[string]string) error {
+		delete(m, key)
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer file.Close()
+	v.emit("unset", key, nil)
+	return nil
+}
+
+// RenamePrefix renames every key beginning with oldPrefix so that it begins
+// with newPrefix instead, returning the number of keys renamed.
+//
+// All renames are applied in a single save, and each key keeps its comment.
+// If any renamed key would collide with an existing key, nothing is written
+// and the colliding key is reported.
+func (v *Vars) RenamePrefix(oldPrefix, newPrefix string) (int, error) {
+	oldPrefix, newPrefix = v.key(oldPrefix), v.key(newPrefix)
+
+	targets := make(map[string]string)
+	err := v.updateComments(func(m, comments map[string]string) error {
+		if oldPrefix == newPrefix {
+			return errUnchanged
+		}
+		for k := range m {
+			if strings.HasPrefix(k, oldPrefix) {
+				targets[k] = newPrefix + strings.TrimPrefix(k, oldPrefix)
+			}
+		}
+		if len(targets) == 0 {
+			return errUnchanged
+		}
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
-			continue
+		for k, target := range targets {
+			if _, exists := m[target]; exists {
+				if _, moving := targets[target]; !moving {
+					return fmt.Errorf("cannot rename %q: key %q already exists", k, target)
+				}
+			}
 		}
 
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) == 2 {
-			key := strings.TrimSpace(parts[0])
-			val := unescape(strings.TrimSpace(parts[1]))
-			data[key] = val
+		vals := make(map[string]string, len(targets))
+		notes := make(map[string]string)
+		for k := range targets {
+			vals[k] = m[k]
+			delete(m, k)
+			if c, ok := comments[k]; ok {
+				notes[k] = c
+				delete(comments, k)
+			}
+		}
+		for k, target := range targets {
+			m[target] = vals[k]
+			if c, ok := notes[k]; ok {
+				comments[target] = c
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
-	return data, scanner.Err()
+	return len(targets), nil
 }
 
-func (v *Vars) save(data map[string]string) error {
-	var buf bytes.Buffer
+// Match returns the variables whose keys match the glob pattern, using
+// [path.Match] semantics. A malformed pattern returns an error wrapping
+// [path.ErrBadPattern].
+func (v *Vars) Match(pattern string) (map[string]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
 
-	keys := make([]string, 0, len(data))
-	for k := range data {
-		keys = append(keys, k)
+	if err := v.rlock(); err != nil {
+		return nil, err
 	}
-	sort.Strings(keys)
+	defer v.runlock()
 
-	for _, k := range keys {
-		buf.WriteString(fmt.Sprintf("%s=%s\n", k, escape(data[k])))
+	m, err := v.view()
+	if err != nil {
+		return nil, err
+	}
+	for k := range m {
+		if ok, _ := path.Match(pattern, k); !ok {
+			delete(m, k)
+		}
 	}
+	return m, nil
+}
 
-	root, err := v.root()
+// KeysWhere returns the sorted keys for which pred reports true (see
+// [WithKeyOrder]).
+func (v *Vars) KeysWhere(pred func(key, val string) bool) ([]string, error) {
+	m, err := v.All()
 	if err != nil {
-		return fmt.Errorf("unable to construct vars.properties path: %w", err)
+		return nil, err
 	}
 
-	return root.WriteFile("vars.properties", buf.Bytes(), 0600)
+	var keys []string
+	for k, val := range m {
+		if pred(k, val) {
+			keys = append(keys, k)
+		}
+	}
+	v.sortKeys(keys)
+	return keys, nil
 }
 
-func escape(s string) string {
-	return strings.ReplaceAll(strings.ReplaceAll(s, "\n", "\\n"), "\r", "\\r")
+// UnsetMatch removes every key matching the glob pattern (see [Vars.Match])
+// in a single save, returning the number of keys removed.
+func (v *Vars) UnsetMatch(pattern string) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+
+	var removed []string
+	err := v.update(func(m map[string]string) error {
+		for k := range m {
+			if ok, _ := path.Match(pattern, k); ok {
+				delete(m, k)
+				removed = append(removed, k)
+			}
+		}
+		if len(removed) == 0 {
+			return errUnchanged
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range removed {
+		v.emit("unset", k, nil)
+	}
+	return len(removed), nil
+}
+
+// Compact rewrites the store in canonical form: sorted by key, with
+// duplicate keys resolved to their last occurrence and comments kept with
+// their keys. It reports whether anything changed; an already canonical
+// file is not rewritten. It is mainly useful with [WithAppendMode] or after
+// editing the file by hand. With a custom backend only keys folded by
+// options such as [WithCaseInsensitiveKeys] can change, and the data is
+// saved again only if one does.
+func (v *Vars) Compact() (bool, error) {
+	if err := v.lock(); err != nil {
+		return false, err
+	}
+	defer v.unlock()
+
+	if v.backend != nil {
+		data, comments, err := v.loadRaw()
+		if err != nil {
+			return false, err
+		}
+		folded, err := v.foldKeys(data)
+		if err != nil {
+			return false, err
+		}
+		foldedComments, _ := v.foldKeys(comments)
+		if maps.Equal(data, folded) && maps.Equal(comments, foldedComments) {
+			return false, nil
+		}
+		return true, v.save(folded, foldedComments)
+	}
+
+	raw, err := v.readRaw()
+	if err != nil {
+		return false, err
+	}
+	data, comments, err := v.decode(bytes.NewReader(raw))
+	if err != nil {
+		return false, err
+	}
+	if data, err = v.foldKeys(data); err != nil {
+		return false, err
+	}
+	comments, _ = v.foldKeys(comments)
+
+	content, err := v.encode(data, comments)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(raw, content) {
+		return false, nil
+	}
+	return true, v.save(data, comments)
+}
+
+// SetWithComment stores the value for the given key like [Vars.Set] and
+// attaches comment to it. The comment is written as "# " lines directly
+// above the key in vars.properties and is kept by later writes until the key
+// is removed. An empty comment removes any existing comment.
+//
+// Comments are not supported by custom backends.
+func (v *Vars) SetWithComment(key, val, comment string) error {
+	if _, ok := v.store().(commenter); !ok {
+		return fmt.Errorf("comments are not supported by a custom backend")
+	}
+	v.metrics.IncrSet()
+
+	key = v.key(key)
+	err := v.updateComments(func(m, comments map[string]string) error {
+		m[key] = val
+		if comment == "" {
+			delete(comments, key)
+		} else {
+			comments[key] = comment
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	v.emit("set", key, nil)
+	return nil
+}
+
+// GetComment returns the comment attached to the given key, or an empty
+// string if it has none.
+//
+// It returns an error if the key does not exist.
+func (v *Vars) GetComment(key string) (string, error) {
+	if err := v.rlock(); err != nil {
+		return "", err
+	}
+	defer v.runlock()
+
+	m, comments, err := v.viewComments()
+	if err != nil {
+		return "", err
+	}
+
+	key = v.key(key)
+	if _, ok := m[key]; !ok {
+		return "", fmt.Errorf("key not found: %s", key)
+	}
+	return comments[key], nil
+}
+
+// Entry is a stored value with the comment attached to its key, if any.
+type Entry struct {
+	Value   string
+	Comment string
+}
+
+// AllWithComments returns every stored variable together with its comment
+// (see [Vars.SetWithComment]), so that each setting can be shown alongside
+// its description. With a custom backend that does not keep comments, every
+// comment is empty.
+func (v *Vars) AllWithComments() (map[string]Entry, error) {
+	if err := v.rlock(); err != nil {
+		return nil, err
+	}
+	defer v.runlock()
+
+	m, comments, err := v.viewComments()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]Entry, len(m))
+	for k, val := range m {
+		entries[k] = Entry{Value: val, Comment: comments[k]}
+	}
+	return entries, nil
+}
+
+// Raw returns the contents of vars.properties exactly as stored, including
+// comments and formatting that [Vars.All] discards.
+//
+// Raw is not supported by custom backends.
+func (v *Vars) Raw() ([]byte, error) {
+	if v.backend != nil {
+		return nil, fmt.Errorf("raw access is not supported by a custom backend")
+	}
+
+	if err := v.rlock(); err != nil {
+		return nil, err
+	}
+	defer v.runlock()
+
+	return v.readRaw()
+}
+
+func (v *Vars) readRaw() ([]byte, error) {
+	if err := v.validate(); err != nil {
+		return nil, err
+	}
+	root, err := v.root()
+	if err != nil {
+		return nil, fmt.Errorf("unable to construct vars.properties path: %w", err)
+	}
+	defer root.Close()
+
+	b, err := root.ReadFile(v.fileName())
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("vars has not been initialized")
+	}
+	return b, err
+}
+
+// CopyTo replaces the contents of dst with the variables, and any comments,
+// stored in v. The destination is initialized first if necessary.
+//
+// It returns an error if v and dst refer to the same store.
+func (v *Vars) CopyTo(dst *Vars) error {
+	if v == dst {
+		return fmt.Errorf("cannot copy a store onto itself")
+	}
+	if v.backend == nil && dst.backend == nil {
+		src, err := v.Path()
+		if err != nil {
+			return err
+		}
+		target, err := dst.Path()
+		if err != nil {
+			return err
+		}
+		if src == target {
+			return fmt.Errorf("cannot copy a store onto itself")
+		}
+	}
+
+	if err := v.rlock(); err != nil {
+		return err
+	}
+	data, comments, err := v.loadRaw()
+	v.runlock()
+	if err != nil {
+		return err
+	}
+
+	if _, err := dst.InitIfNeeded(); err != nil {
+		return err
+	}
+	return dst.updateComments(func(m, c map[string]string) error {
+		clear(m)
+		maps.Copy(m, data)
+		if c != nil {
+			clear(c)
+			maps.Copy(c, comments)
+		}
+		return nil
+	})
+}
+
+// Equal reports whether v and other hold the same keys and values. Ordering
+// and comments are ignored.
+func (v *Vars) Equal(other *Vars) (bool, error) {
+	a, err := v.All()
+	if err != nil {
+		return false, err
+	}
+	b, err := other.All()
+	if err != nil {
+		return false, err
+	}
+	return maps.Equal(a, b), nil
+}
+
+// Hash returns the hex-encoded SHA-256 digest of the store's keys and
+// values. The digest covers each key and then its value, in sorted key
+// order, each written as its length in bytes in decimal, a colon and its
+// bytes. Comments, the order of lines in the file and formatting options such
+// as [WithDelimiter], [WithFinalNewline] and [WithKeyOrder] do not affect
+// it, so it changes only when the data does.
+func (v *Vars) Hash() (string, error) {
+	m, err := v.All()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		for _, s := range []string{k, m[k]} {
+			fmt.Fprintf(h, "%d:%s", len(s), s)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Destroy deletes vars.properties, along with its timestamps, change log and
+// backups, and then removes its directory if it is left empty. Afterwards
+// the store must be initialized again before use.
+//
+// As a safeguard, Destroy refuses to delete a file that does not lie beneath
+// the state directory once symbolic links are resolved. Destroy is not
+// supported by custom backends.
+func (v *Vars) Destroy() error {
+	if v.backend != nil {
+		return fmt.Errorf("destroy is not supported by a custom backend")
+	}
+
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	path, err := v.Path()
+	if err != nil {
+		return err
+	}
+	if err := v.checkUnderStateDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("vars has not been initialized")
+		}
+		return err
+	}
+
+	for _, sidecar := range []string{v.timesFile(), v.logFile()} {
+		if err := os.Remove(filepath.Join(filepath.Dir(path), sidecar)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for gen := 1; ; gen++ {
+		err := os.Remove(filepath.Join(filepath.Dir(path), v.backupFile(gen)))
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Only succeeds if nothing else, such as a nested scope, remains.
+	os.Remove(filepath.Dir(path))
+	return nil
+}
+
+// checkUnderStateDir returns an error unless dir, with symbolic links
+// resolved, is beneath the state directory.
+func (v *Vars) checkUnderStateDir(dir string) error {
+	rootDir, err := v.stateDir()
+	if err != nil {
+		return err
+	}
+	if rootDir, err = filepath.Abs(rootDir); err != nil {
+		return err
+	}
+	if rootDir, err = filepath.EvalSymlinks(rootDir); err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(dir)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("vars has not been initialized")
+	}
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(rootDir, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("refusing to modify %s: it is outside the state directory %s", dir, rootDir)
+	}
+	return nil
+}
+
+// RenameTo moves the store on disk so that it is found by dst instead of v.
+// If neither has a scope the whole namespace directory is renamed, taking
+// every scope with it; if both have one, only v's scope is moved. The
+// destination must not already exist.
+//
+// RenameTo is not supported by custom backends.
+func (v *Vars) RenameTo(dst *Vars) error {
+	if v.backend != nil || dst.backend != nil {
+		return fmt.Errorf("rename is not supported by a custom backend")
+	}
+	if (v.scope == "") != (dst.scope == "") {
+		return fmt.Errorf("cannot rename between a namespace and a scope")
+	}
+
+	if err := v.lock(); err != nil {
+		return err
+	}
+	defer v.unlock()
+
+	// The paths to move: a namespace or scope directory, or with the flat
+	// layout a scope's file, its sidecars and its backups.
+	src, err := v.basePath()
+	if err != nil {
+		return err
+	}
+	target, err := dst.basePath()
+	if err != nil {
+		return err
+	}
+	from, to := []string{src}, []string{target}
+	if v.flatLayout && v.scope != "" {
+		from = []string{filepath.Join(src, v.fileName()), filepath.Join(src, v.timesFile()), filepath.Join(src, v.logFile())}
+		to = []string{filepath.Join(target, dst.fileName()), filepath.Join(target, dst.timesFile()), filepath.Join(target, dst.logFile())}
+		for gen := 1; ; gen++ {
+			backup := filepath.Join(src, v.backupFile(gen))
+			if _, err := os.Lstat(backup); os.IsNotExist(err) {
+				break
+			}
+			from = append(from, backup)
+			to = append(to, filepath.Join(target, dst.backupFile(gen)))
+		}
+	}
+
+	if err := v.checkUnderStateDir(src); err != nil {
+		return err
+	}
+	if _, err := os.Stat(from[0]); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("vars has not been initialized")
+		}
+		return err
+	}
+	if _, err := os.Lstat(to[0]); err == nil {
+		return fmt.Errorf("cannot rename to %s: it already exists", to[0])
+	}
+	if err := v.mkdirAll(filepath.Dir(to[0])); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+	// A new namespace is created directly in the state directory, which
+	// its validated name already guarantees.
+	if dst.scope != "" {
+		if err := dst.checkUnderStateDir(filepath.Dir(to[0])); err != nil {
+			return err
+		}
+	}
+
+	for i := range from {
+		if err := os.Rename(from[i], to[i]); err != nil && (i == 0 || !os.IsNotExist(err)) {
+			return err
+		}
+	}
+	v.emit("rename", "", nil)
+	return nil
+}
+
+// All returns a copy of all stored variables as a map.
+func (v *Vars) All() (map[string]string, error) {
+	if err := v.rlock(); err != nil {
+		return nil, err
+	}
+	defer v.runlock()
+	return v.view()
+}
+
+// Values returns the stored values, one per key, in sorted key order (see
+// [WithKeyOrder]).
+func (v *Vars) Values() ([]string, error) {
+	m, err := v.All()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	v.sortKeys(keys)
+
+	vals := make([]string, len(keys))
+	for i, k := range keys {
+		vals[i] = m[k]
+	}
+	return vals, nil
+}
+
+// Edit opens the properties file in the user's preferred editor.
+//
+// It resolves the editor in the following order:
+//  1. The "VISUAL" environment variable.
+//  2. The "EDITOR" environment variable.
+//  3. A fallback to "notepad" on Windows and "vi" elsewhere.
+//
+// The editor may include arguments and shell-style quoting, such as
+// `"/Applications/My Editor.app/Contents/MacOS/editor" --wait`.
+//
+// This method blocks until the editor process completes.
+func (v *Vars) Edit() error {
+	if v.backend != nil {
+		return fmt.Errorf("edit is not supported by a custom backend")
+	}
+
+	filePath, err := v.Path()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return fmt.Errorf("vars not initialized for %q (run 'init' first)", v.namespace)
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = defaultEditor
+	}
+
+	parts, err := splitWords(editor)
+	if err != nil {
+		return fmt.Errorf("invalid editor: %w", err)
+	}
+	if len(parts) == 0 {
+		parts = []string{defaultEditor}
+	}
+	executable := parts[0]
+	args := parts[1:]
+	args = append(args, filePath)
+
+	cmd := exec.Command(executable, args...)
+
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
 }
 
-func unescape(s string) string {
-	return strings.ReplaceAll(strings.ReplaceAll(s, "\\n", "\n"), "\\r", "\r")
+// storeLocks holds one mutex per properties file, keyed by its absolute
+// path, so that every Vars in the process referring to the same file
+// serializes its access even if each was created by a separate call to New.
+var storeLocks sync.Map
+
+// mutex returns the lock shared by all Vars for the same file. A custom
+// backend, or a store whose path cannot be resolved, uses v's own mutex.
+// The choice is made on first use and kept, so that an unlock always
+// releases the mutex that was locked even if the path has changed since.
+func (v *Vars) mutex() *sync.RWMutex {
+	v.muOnce.Do(func() {
+		v.sharedMu = &v.mu
+		if v.backend != nil {
+			return
+		}
+		if path, err := v.Path(); err == nil {
+			mu, _ := storeLocks.LoadOrStore(path, new(sync.RWMutex))
+			v.sharedMu = mu.(*sync.RWMutex)
+		}
+	})
+	return v.sharedMu
+}
+
+// ErrLockTimeout is returned when a store's lock cannot be acquired within
+// the time set by [WithLockTimeout].
+var ErrLockTimeout = errors.New("vars: timed out waiting for lock")
+
+func (v *Vars) lock() error {
+	return v.acquireLock(v.lockTimeout)
+}
+
+// acquireLock takes the write lock, failing with ErrLockTimeout once
+// timeout has passed; a timeout of zero or less waits indefinitely.
+func (v *Vars) acquireLock(timeout time.Duration) error {
+	if v.noLock {
+		return nil
+	}
+	mu := v.mutex()
+	return v.acquire(mu.TryLock, mu.Lock, timeout)
+}
+
+func (v *Vars) unlock() {
+	if !v.noLock {
+		v.mutex().Unlock()
+	}
+}
+
+func (v *Vars) rlock() error {
+	if v.noLock {
+		return nil
+	}
+	mu := v.mutex()
+	return v.acquire(mu.TryRLock, mu.RLock, v.lockTimeout)
+}
+
+// acquire takes a lock with try, reporting contention, and then waits for it
+// with wait or, given a timeout, by polling try until the deadline.
+func (v *Vars) acquire(try func() bool, wait func(), timeout time.Duration) error {
+	if try() {
+		return nil
+	}
+	v.emit("lock_contention", "", nil)
+	if timeout <= 0 {
+		wait()
+		return nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for delay := time.Millisecond; ; delay = min(2*delay, 50*time.Millisecond) {
+		time.Sleep(min(delay, time.Until(deadline)))
+		if try() {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			err := fmt.Errorf("%w after %s", ErrLockTimeout, timeout)
+			v.emit("lock_timeout", "", err)
+			return err
+		}
+	}
+}
+
+func (v *Vars) runlock() {
+	if !v.noLock {
+		v.mutex().RUnlock()
+	}
+}
+
+// errUnchanged is returned by an update function to skip the save when it
+// has nothing to write.
+var errUnchanged = errors.New("vars: unchanged")
+
+// errWritten is returned by an update function that has already persisted
+// its change, so the save is skipped. The function must still apply the
+// change to the map it was given.
+var errWritten = errors.New("vars: written")
+
+// update loads the store under the write lock, applies fn to the data, and
+// saves the result. Key collisions introduced by key folding are reported
+// here rather than on read, so that they surface before anything is written.
+func (v *Vars) update(fn func(m map[string]string) error) error {
+	return v.updateComments(func(m, _ map[string]string) error {
+		return fn(m)
+	})
+}
+
+// updateComments is like update but also passes the comment attached to each
+// key. The comments map is nil if the backend does not support comments.
+// Comments for keys removed by fn are discarded.
+//
+// Once the lock is released, the [WithOnChange] callback is called with the
+// new contents if anything was written.
+func (v *Vars) updateComments(fn func(m, comments map[string]string) error) error {
+	m, err := v.apply(fn)
+	if err != nil || m == nil {
+		return err
+	}
+	v.notify(m)
+	return nil
+}
+
+// apply performs the locked part of updateComments, returning the contents
+// that were written, or nil if fn made no change.
+func (v *Vars) apply(fn func(m, comments map[string]string) error) (map[string]string, error) {
+	if err := v.lock(); err != nil {
+		return nil, err
+	}
+	defer v.unlock()
+
+	if v.autoInit {
+		if _, err := v.InitIfNeeded(); err != nil {
+			return nil, err
+		}
+	}
+
+	m, comments, err := v.loadRaw()
+	if err != nil {
+		return nil, err
+	}
+	m, err = v.foldKeys(m)
+	if err != nil {
+		return nil, err
+	}
+	if comments != nil {
+		comments, _ = v.foldKeys(comments)
+	}
+	before := maps.Clone(m)
+	var beforeComments map[string]string
+	if v.skipUnchanged {
+		beforeComments = maps.Clone(comments)
+	}
+	if err := fn(m, comments); err != nil {
+		switch {
+		case errors.Is(err, errUnchanged):
+			return nil, nil
+		case errors.Is(err, errWritten):
+			return m, v.recordWrite(before, m)
+		}
+		return nil, err
+	}
+	// Every write path passes through here, including those of custom
+	// backends, so keys are checked once for all of them.
+	for k := range m {
+		if _, ok := before[k]; !ok {
+			if err := v.checkKey(k); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for k := range comments {
+		if _, ok := m[k]; !ok {
+			delete(comments, k)
+		}
+	}
+	if v.skipUnchanged && maps.Equal(before, m) && maps.Equal(beforeComments, comments) {
+		return nil, nil
+	}
+	if err := v.save(m, comments); err != nil {
+		return nil, err
+	}
+	return m, v.recordWrite(before, m)
+}
+
+// tracksChanges reports whether writes need the variables held before them
+// to record what changed.
+func (v *Vars) tracksChanges() bool {
+	return v.keyTimes || v.changeLog > 0 || v.audit != nil
+}
+
+// recordWrite updates the sidecar files, the audit log and the env mirror
+// after a write that changed before into after.
+func (v *Vars) recordWrite(before, after map[string]string) error {
+	if err := v.touchKeys(before, after); err != nil {
+		return err
+	}
+	if err := v.logChanges(before, after); err != nil {
+		return err
+	}
+	if err := v.auditChanges(before, after); err != nil {
+		return err
+	}
+	return v.mirrorEnv(after)
+}
+
+// view loads the store as seen by reads: with [WithScopeInheritsRoot], the
+// keys of the namespace root that the scope does not override are merged in.
+// The caller holds v's read lock; the root's is taken here.
+func (v *Vars) view() (map[string]string, error) {
+	m, _, err := v.viewComments()
+	return m, err
+}
+
+// viewComments is like view but also returns the comment attached to each
+// key, taking an inherited key's comment from the namespace root.
+func (v *Vars) viewComments() (data, comments map[string]string, err error) {
+	data, comments, err = v.loadRaw()
+	if err != nil {
+		return nil, nil, err
+	}
+	data, _ = v.foldKeys(data)
+	comments, _ = v.foldKeys(comments)
+	if !v.inheritRoot || v.scope == "" || v.backend != nil {
+		return data, comments, nil
+	}
+
+	root := v.sibling("")
+	if ok, err := root.IsInitialized(); err != nil || !ok {
+		return data, comments, err
+	}
+	if err := root.rlock(); err != nil {
+		return nil, nil, err
+	}
+	defer root.runlock()
+
+	inherited, notes, err := root.loadRaw()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read the namespace root: %w", err)
+	}
+	inherited, _ = root.foldKeys(inherited)
+	notes, _ = root.foldKeys(notes)
+	if comments == nil && notes != nil {
+		comments = make(map[string]string)
+	}
+	for k, val := range inherited {
+		if _, ok := data[k]; !ok {
+			data[k] = val
+			if c, ok := notes[k]; ok {
+				comments[k] = c
+			}
+		}
+	}
+	return data, comments, nil
+}
+
+// sibling returns a Vars for another scope of v's namespace, configured with
+// the same state directory and options, such as the layout needed to
+// resolve its path.
+func (v *Vars) sibling(scope string) *Vars {
+	s := New(v.namespace).With(v.opts...)
+	s.scope = scope
+	s.stateDir = v.stateDir
+	return s
+}
+
+func (v *Vars) load() (map[string]string, error) {
+	m, _, err := v.loadRaw()
+	if err != nil {
+		return nil, err
+	}
+	m, _ = v.foldKeys(m)
+	return m, nil
+}
+
+func (v *Vars) loadRaw() (data, comments map[string]string, err error) {
+	start := time.Now()
+	if err := v.validate(); err != nil {
+		return nil, nil, err
+	}
+	err = v.retry(func() (err error) {
+		if c, ok := v.store().(commenter); ok {
+			data, comments, err = c.LoadWithComments()
+		} else {
+			data, err = v.store().Load()
+		}
+		return err
+	})
+	v.metrics.ObserveLoadDuration(time.Since(start))
+	if err != nil {
+		v.emit("load_error", "", err)
+	}
+	return data, comments, err
+}
+
+func (v *Vars) save(data, comments map[string]string) error {
+	start := time.Now()
+	defer func() {
+		v.metrics.ObserveSaveDuration(time.Since(start))
+	}()
+
+	if r, ok := v.store().(rotator); ok && v.backups > 0 {
+		if err := r.rotateBackups(); err != nil {
+			return err
+		}
+	}
+	return v.retry(func() error {
+		if c, ok := v.store().(commenter); ok {
+			return c.SaveWithComments(data, comments)
+		}
+		return v.store().Save(data)
+	})
 }
@@ -1,13 +1,25 @@
 package vars
 
 import (
+	"archive/tar"
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
+	"time"
 )
 
 // --- TEST: Core Logic & Edge Cases ---
@@ -163,6 +175,55 @@ func TestEdit(t *testing.T) {
 	if err := v.Edit(); err != nil {
 		t.Errorf("Edit() failed with mock editor: %v", err)
 	}
+
+	// --- Case 3: A quoted editor path containing spaces, with flags ---
+	spaced := filepath.Join(tempDir, "My Editor", "editor")
+	argsFile := filepath.Join(tempDir, "args")
+	os.MkdirAll(filepath.Dir(spaced), 0755)
+	script := []byte("#!/bin/sh\nprintf '%s\\n' \"$@\" > '" + argsFile + "'\n")
+	if err := os.WriteFile(spaced, script, 0755); err != nil {
+		t.Fatalf("Failed to create mock editor: %v", err)
+	}
+
+	t.Setenv("VISUAL", `"`+spaced+`" --wait 'two words'`)
+	if err := v.Edit(); err != nil {
+		t.Fatalf("Edit() failed with quoted editor: %v", err)
+	}
+	path, _ := v.Path()
+	got, _ := os.ReadFile(argsFile)
+	if want := "--wait\ntwo words\n" + path + "\n"; string(got) != want {
+		t.Errorf("editor received args %q, want %q", got, want)
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "vi", want: []string{"vi"}},
+		{in: "code --wait", want: []string{"code", "--wait"}},
+		{in: `"/Applications/My Editor" --wait`, want: []string{"/Applications/My Editor", "--wait"}},
+		{in: `'/opt/my editor/bin/ed' -n`, want: []string{"/opt/my editor/bin/ed", "-n"}},
+		{in: `/opt/my\ editor/ed`, want: []string{"/opt/my editor/ed"}},
+		{in: `emacs --eval "(message \"hi\")"`, want: []string{"emacs", "--eval", `(message "hi")`}},
+		{in: `C:\Tools\edit.exe /w`, want: []string{`C:\Tools\edit.exe`, "/w"}},
+		{in: `ed ""`, want: []string{"ed", ""}},
+		{in: "  ", want: nil},
+		{in: `"unterminated`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := splitWords(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("splitWords(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("splitWords(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
 }
 
 // --- TEST: Concurrency ---
@@ -236,3 +297,3294 @@ func TestEmbeddedCmdIntegration(t *testing.T) {
 		t.Errorf("CLI Data failed (did you fix args?): %v", err)
 	}
 }
+
+func TestPath(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+
+	rootCmd := NewCmd("path-test", "timer")
+	buf := new(bytes.Buffer)
+	rootCmd.SetOut(buf)
+	rootCmd.SetErr(buf)
+	rootCmd.SetArgs([]string{"path"})
+
+	// The path is printed even before the store exists.
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("CLI Path failed: %v", err)
+	}
+
+	want := filepath.Join(tempDir, "path-test", "timer", "vars.properties")
+	if got := strings.TrimSpace(buf.String()); got != want {
+		t.Errorf("Path mismatch.\nWant: %q\nGot:  %q", want, got)
+	}
+
+	if _, err := New("bad name!").Path(); err == nil {
+		t.Error("Path should fail for an invalid namespace")
+	}
+}
+
+func TestFileModes(t *testing.T) {
+	tempDir := t.TempDir()
+	v := New("shared-svc").With(WithDirMode(0750), WithFileMode(0640))
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	if err := v.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("token", "abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := os.Stat(filepath.Join(tempDir, "shared-svc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := dir.Mode().Perm(); got != 0750 {
+		t.Errorf("Dir mode mismatch. Want: %#o Got: %#o", 0750, got)
+	}
+
+	file, err := os.Stat(filepath.Join(tempDir, "shared-svc", "vars.properties"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := file.Mode().Perm(); got != 0640 {
+		t.Errorf("File mode mismatch. Want: %#o Got: %#o", 0640, got)
+	}
+
+	// World-readable modes must be explicitly opted into.
+	w := New("world").With(WithFileMode(0644))
+	w.stateDir = v.stateDir
+	if err := w.Init(); err == nil {
+		t.Error("Init should reject a world-readable file mode")
+	}
+
+	w.With(WithWorldAccess())
+	if err := w.Init(); err != nil {
+		t.Errorf("Init failed with WithWorldAccess: %v", err)
+	}
+}
+
+func TestIsInitialized(t *testing.T) {
+	v := New("onboarding")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	ok, err := v.IsInitialized()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("IsInitialized should be false before Init")
+	}
+
+	v.Init()
+
+	ok, err = v.IsInitialized()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("IsInitialized should be true after Init")
+	}
+
+	if _, err := New("bad name!").IsInitialized(); err == nil {
+		t.Error("IsInitialized should fail for an invalid namespace")
+	}
+}
+
+func TestInitIfNeeded(t *testing.T) {
+	v := New("first-run")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	created, err := v.InitIfNeeded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Error("InitIfNeeded should report created on first call")
+	}
+
+	v.Set("theme", "dark")
+
+	created, err = v.InitIfNeeded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created {
+		t.Error("InitIfNeeded should not report created on second call")
+	}
+
+	if val, _ := v.Get("theme"); val != "dark" {
+		t.Error("InitIfNeeded modified existing data")
+	}
+}
+
+func TestInitForce(t *testing.T) {
+	v := New("reset-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("theme", "dark")
+	v.Set("lang", "en")
+
+	// A plain Init must never destroy data.
+	v.Init()
+	if val, _ := v.Get("theme"); val != "dark" {
+		t.Fatal("Init destroyed existing data")
+	}
+
+	if err := v.InitForce(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := v.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 {
+		t.Errorf("Expected empty store after InitForce, got %v", data)
+	}
+}
+
+func TestNestedScopes(t *testing.T) {
+	tempDir := t.TempDir()
+	stateDir := func() (string, error) {
+		return tempDir, nil
+	}
+
+	tests := []struct {
+		name    string
+		scope   string
+		wantErr bool
+	}{
+		{"Two Levels", "prod/eu-west", false},
+		{"Three Levels", "prod/eu-west/a", false},
+		{"Parent Segment", "prod/../../escape", true},
+		{"Leading Parent", "../escape", true},
+		{"Dot Segment", "prod/./eu", true},
+		{"Empty Segment", "prod//eu", true},
+		{"Invalid Char Segment", "prod/eu!", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New("deploy", tt.scope).With(WithNestedScopes())
+			v.stateDir = stateDir
+
+			err := v.Init()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for scope %q, got nil", tt.scope)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Init failed for scope %q: %v", tt.scope, err)
+			}
+
+			want := filepath.Join(tempDir, "deploy", filepath.FromSlash(tt.scope), "vars.properties")
+			if _, err := os.Stat(want); err != nil {
+				t.Errorf("Expected store at %s: %v", want, err)
+			}
+		})
+	}
+
+	// Without the option, nesting remains an error.
+	v := New("deploy", "prod/eu-west")
+	v.stateDir = stateDir
+	if err := v.Init(); err == nil {
+		t.Error("Nested scope should fail without WithNestedScopes")
+	}
+}
+
+func TestPathTraversal(t *testing.T) {
+	tests := []struct {
+		name  string
+		ns    string
+		scope []string
+	}{
+		{"Parent Namespace", "..", nil},
+		{"Dot Namespace", ".", nil},
+		{"Slashed Namespace", "foo/..", nil},
+		{"Parent Scope", "app", []string{".."}},
+		{"Dot Scope", "app", []string{"."}},
+		{"Slashed Scope", "app", []string{"foo/.."}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New(tt.ns, tt.scope...)
+			v.stateDir = func() (string, error) {
+				t.Fatal("state dir accessed before validation")
+				return "", nil
+			}
+			if err := v.Init(); err == nil {
+				t.Errorf("Expected error for %q %v, got nil", tt.ns, tt.scope)
+			}
+		})
+	}
+}
+
+func TestRenamePrefix(t *testing.T) {
+	v := New("reorg")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("old.theme", "dark")
+	v.Set("old.lang", "en")
+	v.Set("other", "keep")
+
+	n, err := v.RenamePrefix("old.", "new.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 keys renamed, got %d", n)
+	}
+
+	data, _ := v.All()
+	want := map[string]string{"new.theme": "dark", "new.lang": "en", "other": "keep"}
+	if fmt.Sprint(data) != fmt.Sprint(want) {
+		t.Errorf("Rename mismatch.\nWant: %v\nGot:  %v", want, data)
+	}
+
+	// --- Colliding rename leaves the store unchanged ---
+	v.Set("old.theme", "light")
+	if _, err := v.RenamePrefix("old.", "new."); err == nil {
+		t.Error("Expected collision error, got nil")
+	} else if !strings.Contains(err.Error(), "new.theme") {
+		t.Errorf("Collision error should name the key, got: %v", err)
+	}
+
+	if val, _ := v.Get("old.theme"); val != "light" {
+		t.Error("Colliding rename modified the store")
+	}
+
+	// --- Comments move with their keys ---
+	v.SetWithComment("note.a", "1", "note")
+	if _, err := v.RenamePrefix("note.", "memo."); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := v.GetComment("memo.a"); err != nil || c != "note" {
+		t.Errorf("comment after rename = %q, %v; want note", c, err)
+	}
+	if raw, _ := v.Raw(); strings.Contains(string(raw), "note.a") || !strings.Contains(string(raw), "# note\nmemo.a=1\n") {
+		t.Errorf("file after rename = %q, want the comment above memo.a", raw)
+	}
+}
+
+func TestNewValidated(t *testing.T) {
+	tests := []struct {
+		name    string
+		ns      string
+		scope   []string
+		wantErr bool
+	}{
+		{"Valid Namespace", "pomo", nil, false},
+		{"Valid Scope", "pomo", []string{"timer"}, false},
+		{"Empty Namespace", "", nil, true},
+		{"Invalid Namespace", "pomo!", nil, true},
+		{"Nested Scope (Variadic)", "pomo", []string{"timer", "work"}, true},
+		{"Nested Scope (Slash)", "pomo", []string{"timer/work"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewValidated(tt.ns, tt.scope...)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %q %v, got nil", tt.ns, tt.scope)
+				}
+				return
+			}
+			if err != nil || v == nil {
+				t.Errorf("NewValidated failed for %q %v: %v", tt.ns, tt.scope, err)
+			}
+		})
+	}
+}
+
+func TestNewCmdE(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("NewCmdE panicked: %v", r)
+		}
+	}()
+
+	if _, err := NewCmdE("pomo", "timer", "work"); err == nil {
+		t.Error("Expected error for nested scope, got nil")
+	}
+	if _, err := NewCmdE("pomo!"); err == nil {
+		t.Error("Expected error for invalid namespace, got nil")
+	}
+
+	cmd, err := NewCmdE("pomo", "timer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Use != "vars" {
+		t.Errorf("Unexpected command: %q", cmd.Use)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	type event struct {
+		name   string
+		fields map[string]any
+	}
+	var events []event
+
+	v := New("audit-app", "prod").With(WithLogger(func(name string, fields map[string]any) {
+		events = append(events, event{name, fields})
+	}))
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	v.Get("missing")
+	v.Init()
+	v.Set("theme", "dark")
+	v.Unset("theme")
+
+	want := []string{"load_error", "init", "set", "unset"}
+	if len(events) != len(want) {
+		t.Fatalf("Expected events %v, got %v", want, events)
+	}
+	for i, e := range events {
+		if e.name != want[i] {
+			t.Errorf("Event %d: want %q, got %q", i, want[i], e.name)
+		}
+		if e.fields["namespace"] != "audit-app" || e.fields["scope"] != "prod" {
+			t.Errorf("Event %q missing namespace/scope fields: %v", e.name, e.fields)
+		}
+	}
+	if events[0].fields["error"] == nil {
+		t.Error("load_error event should carry the error")
+	}
+	if events[2].fields["key"] != "theme" {
+		t.Errorf("set event should carry the key, got %v", events[2].fields)
+	}
+}
+
+type fakeMetrics struct {
+	gets, sets, unsets int
+	loads, saves       int
+}
+
+func (m *fakeMetrics) IncrGet()                            { m.gets++ }
+func (m *fakeMetrics) IncrSet()                            { m.sets++ }
+func (m *fakeMetrics) IncrUnset()                          { m.unsets++ }
+func (m *fakeMetrics) ObserveLoadDuration(d time.Duration) { m.loads++ }
+func (m *fakeMetrics) ObserveSaveDuration(d time.Duration) { m.saves++ }
+
+func TestMetrics(t *testing.T) {
+	m := &fakeMetrics{}
+	v := New("metrics-app").With(WithMetrics(m))
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	v.Set("a", "1")
+	v.Set("b", "2")
+	v.Get("a")
+	v.Unset("b")
+
+	if m.gets != 1 || m.sets != 2 || m.unsets != 1 {
+		t.Errorf("Unexpected counters: gets=%d sets=%d unsets=%d", m.gets, m.sets, m.unsets)
+	}
+	if m.loads != 4 || m.saves != 3 {
+		t.Errorf("Unexpected observations: loads=%d saves=%d", m.loads, m.saves)
+	}
+}
+
+func TestTxn(t *testing.T) {
+	v := New("txn-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("theme", "dark")
+	v.Set("lang", "en")
+
+	// --- Case 1: Commit applies all changes ---
+	txn, err := v.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Set("theme", "light")
+	txn.Unset("lang")
+	txn.Set("font", "mono")
+
+	if val, _ := txn.Get("theme"); val != "light" {
+		t.Errorf("Txn should see its own writes, got %q", val)
+	}
+
+	// --- Case 2: Uncommitted changes leave the file unchanged ---
+	if val, _ := v.Get("theme"); val != "dark" {
+		t.Error("Uncommitted Txn modified the store")
+	}
+
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := v.All()
+	want := map[string]string{"theme": "light", "font": "mono"}
+	if !maps.Equal(data, want) {
+		t.Errorf("Commit mismatch.\nWant: %v\nGot:  %v", want, data)
+	}
+
+	if err := txn.Commit(); err == nil {
+		t.Error("Second Commit should fail")
+	}
+
+	// --- Case 3: Rollback discards changes ---
+	txn, _ = v.Begin()
+	txn.Set("theme", "blue")
+	txn.Rollback()
+
+	if val, _ := v.Get("theme"); val != "light" {
+		t.Error("Rolled back Txn modified the store")
+	}
+	if err := txn.Set("theme", "blue"); err == nil {
+		t.Error("Set after Rollback should fail")
+	}
+}
+
+type memBackend struct {
+	data  map[string]string
+	saves int
+}
+
+func (b *memBackend) Load() (map[string]string, error) {
+	return maps.Clone(b.data), nil
+}
+
+func (b *memBackend) Save(data map[string]string) error {
+	b.data = maps.Clone(data)
+	b.saves++
+	return nil
+}
+
+func TestCustomBackend(t *testing.T) {
+	b := &memBackend{data: map[string]string{}}
+	v := New("mem-app").With(WithBackend(b))
+	v.stateDir = func() (string, error) {
+		t.Fatal("state dir accessed with a custom backend")
+		return "", nil
+	}
+
+	if err := v.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("theme", "dark"); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := v.Get("theme"); err != nil || val != "dark" {
+		t.Errorf("Get via backend failed: %q, %v", val, err)
+	}
+	if b.data["theme"] != "dark" || b.saves != 1 {
+		t.Errorf("Backend not used for persistence: %v (saves=%d)", b.data, b.saves)
+	}
+
+	// Validation still happens in Vars.
+	bad := New("bad name!").With(WithBackend(b))
+	if err := bad.Set("theme", "light"); err == nil {
+		t.Error("Set should fail for an invalid namespace")
+	}
+}
+
+func TestBytes(t *testing.T) {
+	v := New("binary-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	want := []byte("line1\nline2\r\n\x00\xff\\n=end")
+	if err := v.SetBytes("blob", want); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := v.GetBytes("blob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Bytes mismatch.\nWant: %q\nGot:  %q", want, got)
+	}
+
+	v.Set("plain", "text")
+	if _, err := v.GetBytes("plain"); err == nil {
+		t.Error("GetBytes should fail for a plain value")
+	}
+	if val, _ := v.Get("plain"); val != "text" {
+		t.Error("Plain values should be untouched")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	v := New("glob-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	for _, k := range []string{"timer.work", "timer.break", "timer1", "timer2", "timerA", "theme"} {
+		v.Set(k, "x")
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"timer.*", []string{"timer.break", "timer.work"}},
+		{"timer?", []string{"timer1", "timer2", "timerA"}},
+		{"timer[0-9]", []string{"timer1", "timer2"}},
+		{"t*e", []string{"theme"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			m, err := v.Match(tt.pattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := slices.Sorted(maps.Keys(m))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Match(%q).\nWant: %v\nGot:  %v", tt.pattern, tt.want, got)
+			}
+		})
+	}
+
+	if _, err := v.Match("timer[0-9"); !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("Expected ErrBadPattern, got: %v", err)
+	}
+
+	n, err := v.UnsetMatch("timer?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 keys unset, got %d", n)
+	}
+	if data, _ := v.All(); len(data) != 3 {
+		t.Errorf("Expected 3 keys remaining, got %v", data)
+	}
+}
+
+func TestEmbeddedCmdGlob(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	rootCmd := NewCmd("glob-test")
+
+	buf := new(bytes.Buffer)
+	exec := func(args ...string) error {
+		buf.Reset()
+		rootCmd.SetArgs(args)
+		rootCmd.SetOut(buf)
+		rootCmd.SetErr(buf)
+		return rootCmd.Execute()
+	}
+
+	exec("init")
+	exec("set", "timer.work", "25m")
+	exec("set", "timer.break", "5m")
+	exec("set", "theme", "dark")
+
+	if err := exec("keys", "--glob", "timer.*"); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "timer.break\ntimer.work\n" {
+		t.Errorf("Unexpected keys output: %q", got)
+	}
+
+	if err := exec("unset", "--glob", "timer.*"); err != nil {
+		t.Fatal(err)
+	}
+	if err := exec("data", "--glob", "*"); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "theme=dark\n" {
+		t.Errorf("Unexpected data output: %q", got)
+	}
+}
+
+func TestCaseInsensitiveKeys(t *testing.T) {
+	v := New("case-app").With(WithCaseInsensitiveKeys())
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	if err := v.Set("Theme", "dark"); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := v.Get("theme"); err != nil || val != "dark" {
+		t.Errorf("Get(\"theme\") = %q, %v; want dark", val, err)
+	}
+	if ok, _ := v.Has("THEME"); !ok {
+		t.Error("Has should be case-insensitive")
+	}
+	if err := v.Unset("tHeMe"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := v.Has("theme"); ok {
+		t.Error("Unset should be case-insensitive")
+	}
+
+	// --- Existing mixed-case keys collide on the next write ---
+	file := filepath.Join(tempDir, "case-app", "vars.properties")
+	os.WriteFile(file, []byte("Lang=en\nlang=fr\n"), 0600)
+
+	if err := v.Set("other", "x"); err == nil {
+		t.Error("Expected collision error, got nil")
+	} else if !strings.Contains(err.Error(), "Lang") {
+		t.Errorf("Collision error should name the keys, got: %v", err)
+	}
+
+	got, _ := os.ReadFile(file)
+	if string(got) != "Lang=en\nlang=fr\n" {
+		t.Errorf("Colliding write modified the file: %q", got)
+	}
+}
+
+func TestKeyNormalizer(t *testing.T) {
+	normalize := func(k string) string {
+		return strings.ReplaceAll(strings.ToLower(k), " ", ".")
+	}
+	v := New("normalize-app").With(WithKeyNormalizer(normalize))
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	if err := v.Set("Server Port", "8080"); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := v.Get("server.port"); err != nil || val != "8080" {
+		t.Errorf("Get(\"server.port\") = %q, %v; want 8080", val, err)
+	}
+	if val, err := v.Get("SERVER PORT"); err != nil || val != "8080" {
+		t.Errorf("Get(\"SERVER PORT\") = %q, %v; want 8080", val, err)
+	}
+	if ok, _ := v.Has("server port"); !ok {
+		t.Error("Has should normalize the key")
+	}
+
+	file := filepath.Join(tempDir, "normalize-app", "vars.properties")
+	if got, _ := os.ReadFile(file); string(got) != "server.port=8080\n" {
+		t.Errorf("Key not stored normalized: %q", got)
+	}
+
+	if err := v.Unset("Server Port"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := v.Has("server.port"); ok {
+		t.Error("Unset should normalize the key")
+	}
+}
+
+func TestTrimValues(t *testing.T) {
+	tempDir := t.TempDir()
+	stateDir := func() (string, error) {
+		return tempDir, nil
+	}
+
+	v := New("trim-app")
+	v.stateDir = stateDir
+	v.Init()
+	v.Set("padded", "  padded  ")
+
+	// --- Default: values are trimmed on load ---
+	if val, _ := v.Get("padded"); val != "padded" {
+		t.Errorf("Expected trimmed value, got %q", val)
+	}
+
+	// --- Disabled: values round-trip exactly ---
+	exact := New("trim-app").With(WithTrimValues(false))
+	exact.stateDir = stateDir
+	exact.Set("padded", "  padded  ")
+	if val, _ := exact.Get("padded"); val != "  padded  " {
+		t.Errorf("Expected exact value, got %q", val)
+	}
+}
+
+func TestComments(t *testing.T) {
+	v := New("comment-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	if err := v.SetWithComment("theme", "dark", "UI color scheme"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.SetWithComment("port", "8080", "HTTP listener\nchange with care"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A plain Set must not clobber an existing comment.
+	if err := v.Set("theme", "light"); err != nil {
+		t.Fatal(err)
+	}
+	v.Set("lang", "en")
+
+	file := filepath.Join(tempDir, "comment-app", "vars.properties")
+	got, _ := os.ReadFile(file)
+	want := "lang=en\n# HTTP listener\n# change with care\nport=8080\n# UI color scheme\ntheme=light\n"
+	if string(got) != want {
+		t.Errorf("File mismatch.\nWant: %q\nGot:  %q", want, got)
+	}
+
+	v2 := New("comment-app")
+	v2.stateDir = v.stateDir
+	if c, err := v2.GetComment("theme"); err != nil || c != "UI color scheme" {
+		t.Errorf("GetComment(theme) = %q, %v", c, err)
+	}
+	if c, err := v2.GetComment("port"); err != nil || c != "HTTP listener\nchange with care" {
+		t.Errorf("GetComment(port) = %q, %v", c, err)
+	}
+	if c, err := v2.GetComment("lang"); err != nil || c != "" {
+		t.Errorf("GetComment(lang) = %q, %v", c, err)
+	}
+	if _, err := v2.GetComment("missing"); err == nil {
+		t.Error("GetComment should fail for a missing key")
+	}
+
+	// Removing a key drops its comment.
+	v.Unset("theme")
+	v.Set("theme", "dark")
+	if c, _ := v.GetComment("theme"); c != "" {
+		t.Errorf("Comment should not survive Unset, got %q", c)
+	}
+}
+
+func TestAppendMode(t *testing.T) {
+	v := New("append-app").With(WithAppendMode())
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	v.Set("zeta", "1")
+	v.Set("alpha", "2")
+	v.Set("zeta", "3")
+
+	file := filepath.Join(tempDir, "append-app", "vars.properties")
+	got, _ := os.ReadFile(file)
+	if string(got) != "alpha=2\nzeta=3\n" {
+		// Updating an existing key rewrites the file canonically.
+		t.Errorf("Unexpected file after update: %q", got)
+	}
+
+	v.Set("mid", "4")
+	got, _ = os.ReadFile(file)
+	if string(got) != "alpha=2\nzeta=3\nmid=4\n" {
+		t.Errorf("New key should be appended, got: %q", got)
+	}
+
+	if changed, err := v.Compact(); err != nil || !changed {
+		t.Fatalf("Compact = %v, %v; want changed", changed, err)
+	}
+	got, _ = os.ReadFile(file)
+	if string(got) != "alpha=2\nmid=4\nzeta=3\n" {
+		t.Errorf("Compact should sort the file, got: %q", got)
+	}
+
+	// --- Custom backends report a change only when keys are folded ---
+	b := &memBackend{data: map[string]string{"theme": "dark"}}
+	custom := New("append-app").With(WithBackend(b))
+	if changed, err := custom.Compact(); err != nil || changed || b.saves != 0 {
+		t.Errorf("Compact on a canonical backend = %v, %v (%d saves); want unchanged", changed, err, b.saves)
+	}
+	b.data["Lang"] = "en"
+	folding := New("append-app").With(WithBackend(b), WithCaseInsensitiveKeys())
+	if changed, err := folding.Compact(); err != nil || !changed {
+		t.Errorf("Compact with a key to fold = %v, %v; want changed", changed, err)
+	}
+	if want := map[string]string{"theme": "dark", "lang": "en"}; !maps.Equal(b.data, want) {
+		t.Errorf("backend data after Compact = %v, want %v", b.data, want)
+	}
+}
+
+func benchmarkSet(b *testing.B, opts ...Option) {
+	v := New("bench-app").With(opts...)
+	tempDir := b.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := v.Set(fmt.Sprintf("key_%d", i), "value"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSetRewrite(b *testing.B) { benchmarkSet(b) }
+func BenchmarkSetAppend(b *testing.B)  { benchmarkSet(b, WithAppendMode()) }
+
+// The in-memory backend keeps file I/O from hiding the cost of locking.
+func BenchmarkSetLocked(b *testing.B) {
+	benchmarkSet(b, WithBackend(&memBackend{data: map[string]string{}}))
+}
+
+func BenchmarkSetNoLock(b *testing.B) {
+	benchmarkSet(b, WithBackend(&memBackend{data: map[string]string{}}), WithNoLock())
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	v := New("dup-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	file := filepath.Join(tempDir, "dup-app", "vars.properties")
+	os.WriteFile(file, []byte("# first\ntheme=dark\nlang=en\ntheme=light\n"), 0600)
+
+	if val, _ := v.Get("theme"); val != "light" {
+		t.Errorf("Last occurrence should win, got %q", val)
+	}
+	if c, _ := v.GetComment("theme"); c != "" {
+		t.Errorf("Comment should follow the last occurrence, got %q", c)
+	}
+
+	// Saving deduplicates the file.
+	v.Set("lang", "fr")
+	got, _ := os.ReadFile(file)
+	if string(got) != "lang=fr\ntheme=light\n" {
+		t.Errorf("Save should deduplicate, got: %q", got)
+	}
+}
+
+func TestLargeValue(t *testing.T) {
+	v := New("large-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	val := strings.Repeat("0123456789abcdef", 200*1024/16)
+	if err := v.Set("cert", val); err != nil {
+		t.Fatal(err)
+	}
+
+	v2 := New("large-app")
+	v2.stateDir = v.stateDir
+	got, err := v2.Get("cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != val {
+		t.Errorf("Large value mismatch: got %d bytes, want %d", len(got), len(val))
+	}
+}
+
+func TestFsync(t *testing.T) {
+	tempDir := t.TempDir()
+	stateDir := func() (string, error) {
+		return tempDir, nil
+	}
+
+	for _, opts := range [][]Option{{WithFsync()}, {WithFsync(), WithAppendMode()}} {
+		v := New("durable-app").With(opts...)
+		v.stateDir = stateDir
+		v.Init()
+
+		if err := v.Set("license", "abc"); err != nil {
+			t.Fatalf("Set with fsync failed: %v", err)
+		}
+		if err := v.Set("license", "def"); err != nil {
+			t.Fatalf("Set with fsync failed: %v", err)
+		}
+		if val, _ := v.Get("license"); val != "def" {
+			t.Errorf("Expected def, got %q", val)
+		}
+	}
+}
+
+func TestRaw(t *testing.T) {
+	v := New("raw-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	if _, err := v.Raw(); err == nil || !strings.Contains(err.Error(), "not initialized") {
+		t.Errorf("Expected 'not initialized' error, got: %v", err)
+	}
+
+	v.Init()
+	content := "# orphan comment\n\ntheme=dark\n"
+	os.WriteFile(filepath.Join(tempDir, "raw-app", "vars.properties"), []byte(content), 0600)
+
+	raw, err := v.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != content {
+		t.Errorf("Raw mismatch.\nWant: %q\nGot:  %q", content, raw)
+	}
+
+	data, _ := v.All()
+	if len(data) != 1 || data["theme"] != "dark" {
+		t.Errorf("Unexpected All: %v", data)
+	}
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	v := New("seed-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("theme", "custom")
+
+	if ok, err := v.SetIfAbsent("theme", "default"); err != nil || ok {
+		t.Errorf("SetIfAbsent on existing key = %v, %v; want false", ok, err)
+	}
+	if val, _ := v.Get("theme"); val != "custom" {
+		t.Error("SetIfAbsent clobbered an existing value")
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	winners := 0
+	for i := 0; i < 50; i++ {
+		wg.Go(func() {
+			ok, err := v.SetIfAbsent("lang", fmt.Sprint(i))
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				mu.Lock()
+				winners++
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	if winners != 1 {
+		t.Errorf("Expected exactly one writer, got %d", winners)
+	}
+}
+
+func TestRender(t *testing.T) {
+	v := New("render-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("host", "example.com")
+	v.Set("port", "8443")
+	v.Set("origin", "https://${host}:${port}")
+	v.Set("login", "${origin}/login")
+	v.Set("self", "x${self}")
+	v.Set("a", "${b}")
+	v.Set("b", "${a}")
+	v.Set("broken", "${nope}/x")
+
+	tests := []struct {
+		key     string
+		want    string
+		wantErr string
+	}{
+		{"origin", "https://example.com:8443", ""},
+		{"login", "https://example.com:8443/login", ""},
+		{"self", "", "self -> self"},
+		{"a", "", "a -> b -> a"},
+		{"broken", "", "unresolved reference ${nope}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := v.Render(tt.key)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Render(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+
+	v.With(WithKeepUnresolved())
+	if got, err := v.Render("broken"); err != nil || got != "${nope}/x" {
+		t.Errorf("Render with WithKeepUnresolved = %q, %v", got, err)
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	v := New("env-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("db.host", "localhost")
+	v.Set("api-key", "s3cr=t")
+	v.Set("port", "5432")
+
+	env, err := v.Environ("app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"APP_API_KEY=s3cr=t", "APP_DB_HOST=localhost", "APP_PORT=5432"}
+	if !slices.Equal(env, want) {
+		t.Errorf("Environ mismatch.\nWant: %v\nGot:  %v", want, env)
+	}
+
+	env, _ = v.Environ("")
+	if env[0] != "API_KEY=s3cr=t" {
+		t.Errorf("Expected unprefixed key, got %q", env[0])
+	}
+
+	// --- Case 2: Keys mapping to the same name are reported ---
+	v.Set("db-host", "remote")
+	v.Set("DB_HOST", "other")
+	_, err = v.Environ("app")
+	if err == nil || !strings.Contains(err.Error(), `"db-host"`) || !strings.Contains(err.Error(), "APP_DB_HOST") {
+		t.Errorf("expected an error naming the colliding keys, got %v", err)
+	}
+	v.Unset("db-host")
+	v.Unset("DB_HOST")
+
+	// --- Case 3: Keys that are not valid names are reported ---
+	colon := New("env-colon-app").With(WithDelimiter(":"))
+	colon.stateDir = v.stateDir
+	colon.Init()
+	for _, key := range []string{"a=b", "9lives", "path/to"} {
+		colon.Set(key, "x")
+		_, err := colon.Environ("")
+		if err == nil || !strings.Contains(err.Error(), strconv.Quote(key)) {
+			t.Errorf("expected an error naming %q, got %v", key, err)
+		}
+		colon.Unset(key)
+	}
+}
+
+type testConfig struct {
+	Theme    string        `vars:"theme"`
+	Retries  int           `vars:"retries"`
+	Verbose  bool          `vars:"verbose"`
+	Ratio    float64       `vars:"ratio"`
+	Timeout  time.Duration `vars:"timeout"`
+	Missing  string        `vars:"missing"`
+	Untagged string
+}
+
+func TestUnmarshal(t *testing.T) {
+	v := New("bind-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("theme", "dark")
+	v.Set("retries", "3")
+	v.Set("verbose", "true")
+	v.Set("ratio", "0.75")
+	v.Set("timeout", "25m")
+	v.Set("unknown", "ignored")
+
+	var cfg testConfig
+	if err := v.Unmarshal(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := testConfig{Theme: "dark", Retries: 3, Verbose: true, Ratio: 0.75, Timeout: 25 * time.Minute}
+	if cfg != want {
+		t.Errorf("Unmarshal mismatch.\nWant: %+v\nGot:  %+v", want, cfg)
+	}
+
+	v.Set("retries", "three")
+	if err := v.Unmarshal(&cfg); err == nil || !strings.Contains(err.Error(), "retries") {
+		t.Errorf("Expected parse error naming the key, got: %v", err)
+	}
+	if err := v.Unmarshal(cfg); err == nil {
+		t.Error("Unmarshal should reject a non-pointer")
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	v := New("marshal-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	in := testConfig{Theme: "dark", Retries: 3, Verbose: true, Ratio: 0.75, Timeout: 90 * time.Second}
+	if err := v.Marshal(&in); err != nil {
+		t.Fatal(err)
+	}
+	if val, _ := v.Get("timeout"); val != "1m30s" {
+		t.Errorf("Expected canonical duration, got %q", val)
+	}
+
+	var out testConfig
+	if err := v.Unmarshal(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("Round-trip mismatch.\nWant: %+v\nGot:  %+v", in, out)
+	}
+
+	// --- omitempty skips zero values ---
+	type sparse struct {
+		Name  string `vars:"name,omitempty"`
+		Count int    `vars:"count,omitempty"`
+	}
+	if err := v.Marshal(sparse{Name: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := v.Has("count"); ok {
+		t.Error("omitempty field with zero value should be skipped")
+	}
+}
+
+func TestDelimiter(t *testing.T) {
+	tempDir := t.TempDir()
+	stateDir := func() (string, error) {
+		return tempDir, nil
+	}
+
+	scopes := map[string]string{":": "colon", "=": "equals"}
+	for delim, scope := range scopes {
+		t.Run(scope, func(t *testing.T) {
+			v := New("delim-app", scope).With(WithDelimiter(delim))
+			v.stateDir = stateDir
+			v.Init()
+
+			if err := v.Set("url", "http://x=y"); err != nil {
+				t.Fatal(err)
+			}
+			if val, _ := v.Get("url"); val != "http://x=y" {
+				t.Errorf("Round-trip mismatch: %q", val)
+			}
+
+			path, _ := v.Path()
+			got, _ := os.ReadFile(path)
+			if want := "url" + delim + "http://x=y\n"; string(got) != want {
+				t.Errorf("File mismatch.\nWant: %q\nGot:  %q", want, got)
+			}
+		})
+	}
+
+	for _, bad := range []string{"", "::", " ", "a", "#", "\t"} {
+		v := New("delim-app").With(WithDelimiter(bad))
+		v.stateDir = stateDir
+		if err := v.Init(); err == nil {
+			t.Errorf("Expected error for delimiter %q", bad)
+		}
+	}
+}
+
+func TestKeysWhere(t *testing.T) {
+	v := New("where-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("theme", "default")
+	v.Set("lang", "default")
+	v.Set("font", "mono")
+	v.Set("timer.work", "25m")
+	v.Set("timer.break", "5m")
+
+	keys, err := v.KeysWhere(func(_, val string) bool { return val == "default" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"lang", "theme"}; !slices.Equal(keys, want) {
+		t.Errorf("Value equality mismatch.\nWant: %v\nGot:  %v", want, keys)
+	}
+
+	re := regexp.MustCompile(`^\d+m$`)
+	keys, _ = v.KeysWhere(func(_, val string) bool { return re.MatchString(val) })
+	if want := []string{"timer.break", "timer.work"}; !slices.Equal(keys, want) {
+		t.Errorf("Regex mismatch.\nWant: %v\nGot:  %v", want, keys)
+	}
+}
+
+func TestStrictParse(t *testing.T) {
+	tempDir := t.TempDir()
+	stateDir := func() (string, error) {
+		return tempDir, nil
+	}
+
+	lenient := New("parse-app")
+	lenient.stateDir = stateDir
+	lenient.Init()
+	os.WriteFile(filepath.Join(tempDir, "parse-app", "vars.properties"), []byte("# header\nlang=en\nthemedark\n"), 0600)
+
+	// --- Lenient: malformed lines are skipped ---
+	data, err := lenient.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 1 || data["lang"] != "en" {
+		t.Errorf("Unexpected lenient data: %v", data)
+	}
+
+	// --- Strict: malformed lines are reported ---
+	strict := New("parse-app").With(WithStrictParse())
+	strict.stateDir = stateDir
+	_, err = strict.All()
+	if err == nil {
+		t.Fatal("Expected error for malformed line, got nil")
+	}
+	if !strings.Contains(err.Error(), ":3:") || !strings.Contains(err.Error(), "themedark") {
+		t.Errorf("Error should name the line number and content, got: %v", err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	v, err := Default("default-app", "prefs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Set("theme", "dark"); err != nil {
+		t.Fatalf("Set failed without a separate Init: %v", err)
+	}
+	if val, _ := v.Get("theme"); val != "dark" {
+		t.Errorf("Expected dark, got %q", val)
+	}
+
+	if _, err := Default("bad name!"); err == nil {
+		t.Error("Default should fail for an invalid namespace")
+	}
+}
+
+func TestAutoInit(t *testing.T) {
+	v := New("auto-app", "prefs").With(WithAutoInit())
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	if err := v.Set("theme", "dark"); err != nil {
+		t.Fatalf("Set failed with WithAutoInit: %v", err)
+	}
+	if val, _ := v.Get("theme"); val != "dark" {
+		t.Errorf("Expected dark, got %q", val)
+	}
+	if ok, _ := v.IsInitialized(); !ok {
+		t.Error("Store should be initialized after the first write")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	v := New("lookup-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	if _, _, err := v.Lookup("theme"); err == nil {
+		t.Error("Lookup should fail if Init() hasn't been called")
+	}
+
+	v.Init()
+	v.Set("theme", "dark")
+
+	if val, ok, err := v.Lookup("theme"); err != nil || !ok || val != "dark" {
+		t.Errorf("Lookup(theme) = %q, %v, %v; want dark, true, nil", val, ok, err)
+	}
+	if val, ok, err := v.Lookup("missing"); err != nil || ok || val != "" {
+		t.Errorf("Lookup(missing) = %q, %v, %v; want \"\", false, nil", val, ok, err)
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	v := New("getmany-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("db.host", "localhost")
+	v.Set("db.port", "5432")
+	v.Set("theme", "dark")
+
+	found, missing, err := v.GetMany("db.host", "db.user", "db.port", "db.pass")
+	if err != nil {
+		t.Fatalf("GetMany failed: %v", err)
+	}
+	want := map[string]string{"db.host": "localhost", "db.port": "5432"}
+	if !maps.Equal(found, want) {
+		t.Errorf("found = %v, want %v", found, want)
+	}
+	if !slices.Equal(missing, []string{"db.user", "db.pass"}) {
+		t.Errorf("missing = %v, want [db.user db.pass]", missing)
+	}
+}
+
+func TestParse(t *testing.T) {
+	input := "# database settings\n" +
+		"db.host=localhost\n" +
+		"\n" +
+		"  port = 5432  \n" +
+		"motd=line one\\nline two\n" +
+		"not a pair\n" +
+		"db.host=127.0.0.1\n"
+
+	got, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := map[string]string{
+		"db.host": "127.0.0.1",
+		"port":    "5432",
+		"motd":    "line one\nline two",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("Parse() = %v, want %v", got, want)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	v := New("format-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	data := map[string]string{
+		"theme":   "dark",
+		"db.host": "localhost",
+		"motd":    "line one\nline two",
+	}
+	for k, val := range data {
+		v.Set(k, val)
+	}
+
+	var buf bytes.Buffer
+	if err := Format(data, &buf); err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	raw, _ := v.Raw()
+	if buf.String() != string(raw) {
+		t.Errorf("Format() = %q, want file contents %q", buf.String(), raw)
+	}
+
+	parsed, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	all, _ := v.All()
+	if !maps.Equal(parsed, all) {
+		t.Errorf("Parse(Format()) = %v, want %v", parsed, all)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tempDir := t.TempDir()
+	stateDir := func() (string, error) {
+		return tempDir, nil
+	}
+	src := New("equal-app")
+	src.stateDir = stateDir
+	dst := New("equal-app", "copy")
+	dst.stateDir = stateDir
+
+	src.Init()
+	src.Set("theme", "dark")
+	src.SetWithComment("db.host", "localhost", "primary database")
+
+	if _, err := src.Equal(dst); err == nil {
+		t.Error("Equal should fail if the other store is not initialized")
+	}
+
+	if err := src.CopyTo(dst); err != nil {
+		t.Fatalf("CopyTo failed: %v", err)
+	}
+	if eq, err := src.Equal(dst); err != nil || !eq {
+		t.Errorf("Equal after copy = %v, %v; want true, nil", eq, err)
+	}
+
+	dst.Set("theme", "light")
+	if eq, err := src.Equal(dst); err != nil || eq {
+		t.Errorf("Equal after mutation = %v, %v; want false, nil", eq, err)
+	}
+}
+
+func TestFlatLayout(t *testing.T) {
+	tempDir := t.TempDir()
+	stateDir := func() (string, error) {
+		return tempDir, nil
+	}
+	newFlat := func(scope ...string) *Vars {
+		v := New("flat-app", scope...).With(WithFlatLayout())
+		v.stateDir = stateDir
+		return v
+	}
+
+	root, ingest, export := newFlat(), newFlat("ingest"), newFlat("export")
+	for _, v := range []*Vars{root, ingest, export} {
+		if err := v.Init(); err != nil {
+			t.Fatalf("Init failed: %v", err)
+		}
+	}
+	root.Set("owner", "root")
+	ingest.Set("owner", "ingest")
+	export.Set("owner", "export")
+
+	// --- Case 1: Each scope is a file directly beneath the namespace ---
+	for scope, name := range map[string]string{"": "vars.properties", "ingest": "ingest.properties", "export": "export.properties"} {
+		want := filepath.Join(tempDir, "flat-app", name)
+		if _, err := os.Stat(want); err != nil {
+			t.Errorf("scope %q: expected file at %s: %v", scope, want, err)
+		}
+	}
+	if p, _ := ingest.Path(); p != filepath.Join(tempDir, "flat-app", "ingest.properties") {
+		t.Errorf("Path() = %q, want ingest.properties beneath the namespace", p)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "flat-app", "ingest")); !os.IsNotExist(err) {
+		t.Error("flat layout should not create a scope directory")
+	}
+
+	// --- Case 2: Scopes do not collide ---
+	for v, want := range map[*Vars]string{root: "root", ingest: "ingest", export: "export"} {
+		if got, _ := v.Get("owner"); got != want {
+			t.Errorf("scope %q: Get(owner) = %q, want %q", v.scope, got, want)
+		}
+	}
+
+	// --- Case 3: The scope "vars" would shadow the root store ---
+	if err := newFlat("vars").Init(); err == nil {
+		t.Error("expected the scope \"vars\" to be rejected in flat layout")
+	}
+}
+
+func TestInvalidKeys(t *testing.T) {
+	v := New("badkey-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("theme", "dark")
+	before, _ := v.Raw()
+
+	for _, key := range []string{"a=b", "line\nbreak", "#comment", " pad", "pad\t"} {
+		if err := v.Set(key, "x"); err == nil {
+			t.Errorf("Set(%q) should be rejected", key)
+		}
+	}
+	if after, _ := v.Raw(); !bytes.Equal(before, after) {
+		t.Errorf("rejected keys modified the file: %q", after)
+	}
+
+	// --- Append mode writes a single line and must reject them too ---
+	v = v.With(WithAppendMode())
+	if err := v.Set("a=b", "x"); err == nil {
+		t.Error("Set(a=b) should be rejected in append mode")
+	}
+	if after, _ := v.Raw(); !bytes.Equal(before, after) {
+		t.Errorf("rejected key was appended: %q", after)
+	}
+
+	var buf bytes.Buffer
+	if err := Format(map[string]string{"a=b": "x"}, &buf); err == nil {
+		t.Error("Format should reject a key containing the delimiter")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	v := New("watch-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	if _, err := v.Watch(context.Background(), time.Millisecond); err == nil {
+		t.Error("Watch should fail if Init() hasn't been called")
+	}
+
+	v.Init()
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := v.Watch(ctx, 5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	v.Set("theme", "dark")
+	select {
+	case m := <-changes:
+		if !maps.Equal(m, map[string]string{"theme": "dark"}) {
+			t.Errorf("Watch sent %v, want theme=dark", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch did not report the change")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-changes:
+		if ok {
+			t.Error("expected the channel to be closed after cancellation")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch did not stop after cancellation")
+	}
+}
+
+func TestDefaultEditor(t *testing.T) {
+	for goos, want := range map[string]string{"windows": "notepad", "linux": "vi", "darwin": "vi"} {
+		if got := fallbackEditor(goos); got != want {
+			t.Errorf("fallbackEditor(%q) = %q, want %q", goos, got, want)
+		}
+	}
+
+	want := "vi"
+	if runtime.GOOS == "windows" {
+		want = "notepad"
+	}
+	if defaultEditor != want {
+		t.Errorf("defaultEditor = %q on %s, want %q", defaultEditor, runtime.GOOS, want)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	v := New("replace-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("theme", "dark")
+	v.SetWithComment("lang", "en", "ui language")
+
+	want := map[string]string{"theme": "light", "db.host": "localhost"}
+	if err := v.Replace(want); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	if got, _ := v.All(); !maps.Equal(got, want) {
+		t.Errorf("All() after Replace = %v, want %v", got, want)
+	}
+	if raw, _ := v.Raw(); strings.Contains(string(raw), "ui language") {
+		t.Errorf("comment of a removed key was kept:\n%s", raw)
+	}
+
+	// --- An invalid key rejects the whole replacement ---
+	if err := v.Replace(map[string]string{"ok": "1", "a=b": "2"}); err == nil {
+		t.Error("expected Replace to reject a key containing the delimiter")
+	}
+	if got, _ := v.All(); !maps.Equal(got, want) {
+		t.Errorf("failed Replace modified the store: %v", got)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	var calls []map[string]string
+	v := New("onchange-app").With(WithOnChange(func(data map[string]string) {
+		calls = append(calls, data)
+	}))
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	// --- Case 1: Failed writes do not fire ---
+	if err := v.Set("theme", "dark"); err == nil {
+		t.Fatal("expected Set to fail before Init")
+	}
+	if len(calls) != 0 {
+		t.Fatalf("callback fired for a failed write: %v", calls)
+	}
+
+	// --- Case 2: Each mutation fires once with the new map ---
+	v.Init()
+	v.Set("theme", "dark")
+	v.Set("lang", "en")
+	v.Unset("theme")
+	v.Replace(map[string]string{"db.host": "localhost"})
+	v.SetIfAbsent("db.host", "ignored")
+
+	want := []map[string]string{
+		{"theme": "dark"},
+		{"theme": "dark", "lang": "en"},
+		{"lang": "en"},
+		{"db.host": "localhost"},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("callback fired %d times, want %d: %v", len(calls), len(want), calls)
+	}
+	for i := range want {
+		if !maps.Equal(calls[i], want[i]) {
+			t.Errorf("call %d = %v, want %v", i, calls[i], want[i])
+		}
+	}
+
+	// --- Case 3: Appended writes fire too, and the lock is released ---
+	calls = nil
+	v = v.With(WithAppendMode(), WithOnChange(func(data map[string]string) {
+		got, err := v.Get("motd")
+		if err != nil || got != "hello" {
+			t.Errorf("Get from callback = %q, %v", got, err)
+		}
+		calls = append(calls, data)
+	}))
+	v.Set("motd", "hello")
+	if len(calls) != 1 || !maps.Equal(calls[0], map[string]string{"db.host": "localhost", "motd": "hello"}) {
+		t.Errorf("append mode callback = %v", calls)
+	}
+}
+
+// flakyBackend fails the first failures calls to Load and Save with err
+// before delegating to memBackend.
+type flakyBackend struct {
+	memBackend
+	failures int
+	err      error
+	calls    int
+}
+
+func (b *flakyBackend) fail() error {
+	b.calls++
+	if b.calls <= b.failures {
+		return b.err
+	}
+	return nil
+}
+
+func (b *flakyBackend) Load() (map[string]string, error) {
+	if err := b.fail(); err != nil {
+		return nil, err
+	}
+	return b.memBackend.Load()
+}
+
+func (b *flakyBackend) Save(data map[string]string) error {
+	if err := b.fail(); err != nil {
+		return err
+	}
+	return b.memBackend.Save(data)
+}
+
+func TestRetry(t *testing.T) {
+	transientErr := fmt.Errorf("write vars: %w", syscall.EAGAIN)
+
+	// --- Case 1: Transient failures are retried until they succeed ---
+	b := &flakyBackend{memBackend: memBackend{data: map[string]string{}}, failures: 2, err: transientErr}
+	v := New("retry-app").With(WithBackend(b), WithRetry(3, time.Millisecond))
+	if err := v.Set("theme", "dark"); err != nil {
+		t.Fatalf("Set should succeed after retries: %v", err)
+	}
+	if b.data["theme"] != "dark" || b.calls != 4 {
+		t.Errorf("expected 2 failed loads, 1 load and 1 save; got %d calls, data %v", b.calls, b.data)
+	}
+
+	// --- Case 2: Retries give up after the configured attempts ---
+	b = &flakyBackend{memBackend: memBackend{data: map[string]string{}}, failures: 5, err: transientErr}
+	v = New("retry-app").With(WithBackend(b), WithRetry(3, time.Millisecond))
+	if _, err := v.All(); !errors.Is(err, syscall.EAGAIN) {
+		t.Errorf("expected EAGAIN after exhausting retries, got %v", err)
+	}
+	if b.calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", b.calls)
+	}
+
+	// --- Case 3: Other errors are not retried ---
+	b = &flakyBackend{memBackend: memBackend{data: map[string]string{}}, failures: 5, err: errors.New("corrupt")}
+	v = New("retry-app").With(WithBackend(b), WithRetry(3, time.Millisecond))
+	if _, err := v.All(); err == nil || b.calls != 1 {
+		t.Errorf("expected a single failed attempt, got %d calls (err %v)", b.calls, err)
+	}
+
+	// --- Case 4: Without WithRetry a single attempt is made ---
+	b = &flakyBackend{memBackend: memBackend{data: map[string]string{}}, failures: 1, err: transientErr}
+	v = New("retry-app").With(WithBackend(b))
+	if _, err := v.All(); err == nil || b.calls != 1 {
+		t.Errorf("expected no retries by default, got %d calls (err %v)", b.calls, err)
+	}
+}
+
+func TestHash(t *testing.T) {
+	tempDir := t.TempDir()
+	stateDir := func() (string, error) {
+		return tempDir, nil
+	}
+	a := New("hash-app", "a")
+	a.stateDir = stateDir
+	b := New("hash-app", "b")
+	b.stateDir = stateDir
+	a.Init()
+	b.Init()
+
+	// Same data in a different file order, with comments and duplicates.
+	path, _ := a.Path()
+	os.WriteFile(path, []byte("theme=dark\nlang=en\n"), 0600)
+	path, _ = b.Path()
+	os.WriteFile(path, []byte("# language\nlang=fr\nlang=en\n\ntheme=dark\n"), 0600)
+
+	ha, err := a.Hash()
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	hb, _ := b.Hash()
+	if ha != hb {
+		t.Errorf("hashes differ for identical data: %s != %s", ha, hb)
+	}
+	if len(ha) != 64 {
+		t.Errorf("expected a hex SHA-256 digest, got %q", ha)
+	}
+
+	// --- Case 2: Formatting options do not change the hash ---
+	c := New("hash-app", "c").With(WithDelimiter(":"), WithFinalNewline(false), WithKeyOrder(func(x, y string) bool { return x > y }))
+	c.stateDir = stateDir
+	c.Init()
+	c.SetMany(map[string]string{"theme": "dark", "lang": "en"})
+	if eq, _ := a.Equal(c); !eq {
+		t.Fatal("expected the stores to be equal")
+	}
+	if hc, _ := c.Hash(); hc != ha {
+		t.Errorf("hash depends on formatting options: %s != %s", hc, ha)
+	}
+
+	// --- Case 3: Keys and values cannot run into each other ---
+	c.Unset("theme")
+	c.Unset("lang")
+	c.Set("a=b", "c")
+	d := New("hash-app", "d").With(WithDelimiter(":"))
+	d.stateDir = stateDir
+	d.Init()
+	d.Set("a", "b=c")
+	if hc, _ := c.Hash(); hc == "" {
+		t.Error("expected a hash for a key containing \"=\"")
+	} else if hd, _ := d.Hash(); hc == hd {
+		t.Error("hash is the same for different keys and values")
+	}
+
+	b.Set("theme", "light")
+	if hb, _ := b.Hash(); hb == ha {
+		t.Error("hash did not change after a value changed")
+	}
+}
+
+func TestFileRefs(t *testing.T) {
+	tempDir := t.TempDir()
+	secrets := filepath.Join(tempDir, "secrets")
+	os.Mkdir(secrets, 0700)
+	v := New("fileref-app").With(WithFileRefs(secrets))
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	secret := filepath.Join(secrets, "token")
+	os.WriteFile(secret, []byte("s3cret"), 0600)
+
+	// --- Case 1: A reference is stored literally and resolved on Get ---
+	v.Set("token", "@file:"+secret)
+	if got, err := v.Get("token"); err != nil || got != "s3cret" {
+		t.Errorf("Get(token) = %q, %v; want s3cret", got, err)
+	}
+	if all, _ := v.All(); all["token"] != "@file:"+secret {
+		t.Errorf("reference not stored literally: %q", all["token"])
+	}
+
+	// --- Case 2: Lookup and GetMany resolve references too ---
+	if got, ok, err := v.Lookup("token"); err != nil || !ok || got != "s3cret" {
+		t.Errorf("Lookup(token) = %q, %v, %v; want s3cret", got, ok, err)
+	}
+	if found, _, err := v.GetMany("token"); err != nil || found["token"] != "s3cret" {
+		t.Errorf("GetMany(token) = %v, %v; want s3cret", found, err)
+	}
+
+	// --- Case 3: A missing referenced file is an error ---
+	v.Set("missing", "@file:"+filepath.Join(secrets, "nope"))
+	if _, err := v.Get("missing"); err == nil {
+		t.Error("expected an error for a missing referenced file")
+	}
+
+	// --- Case 4: Relative, unclean and out-of-root paths are rejected ---
+	outside := filepath.Join(tempDir, "outside")
+	os.WriteFile(outside, []byte("leaked"), 0600)
+	for _, ref := range []string{"@file:token", "@file:" + secrets + "/../outside", "@file:" + outside} {
+		v.Set("bad", ref)
+		if got, err := v.Get("bad"); err == nil {
+			t.Errorf("expected %q to be rejected, got %q", ref, got)
+		}
+	}
+
+	// --- Case 5: A symlink leading out of the root is refused ---
+	link := filepath.Join(secrets, "link")
+	if err := os.Symlink(outside, link); err != nil {
+		t.Fatal(err)
+	}
+	v.Set("bad", "@file:"+link)
+	if got, err := v.Get("bad"); err == nil {
+		t.Errorf("expected the escaping symlink to be refused, got %q", got)
+	}
+	if _, _, err := v.Lookup("bad"); err == nil {
+		t.Error("expected Lookup to refuse the escaping symlink")
+	}
+
+	// --- Case 6: Without the option references are plain values ---
+	plain := New("fileref-app")
+	plain.stateDir = v.stateDir
+	if got, _ := plain.Get("token"); got != "@file:"+secret {
+		t.Errorf("Get without WithFileRefs = %q", got)
+	}
+}
+
+func TestListNamespaces(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", tempDir)
+	os.Mkdir(filepath.Join(tempDir, "not-a-store"), 0700)
+
+	New("alpha").Init()
+	New("beta", "ingest").Init()
+	New("beta", "export").Init()
+
+	names, err := ListNamespaces()
+	if err != nil {
+		t.Fatalf("ListNamespaces failed: %v", err)
+	}
+	if !slices.Equal(names, []string{"alpha", "beta"}) {
+		t.Errorf("ListNamespaces() = %v, want [alpha beta]", names)
+	}
+
+	scopes, err := New("beta").Scopes()
+	if err != nil {
+		t.Fatalf("Scopes failed: %v", err)
+	}
+	if !slices.Equal(scopes, []string{"export", "ingest"}) {
+		t.Errorf("Scopes() = %v, want [export ingest]", scopes)
+	}
+	if scopes, _ := New("alpha").Scopes(); len(scopes) != 0 {
+		t.Errorf("expected no scopes for alpha, got %v", scopes)
+	}
+
+	// --- Nested and flat layouts ---
+	New("gamma", "env/eu").With(WithNestedScopes()).Init()
+	if scopes, _ := New("gamma").With(WithNestedScopes()).Scopes(); !slices.Equal(scopes, []string{"env/eu"}) {
+		t.Errorf("nested Scopes() = %v, want [env/eu]", scopes)
+	}
+	New("delta", "ingest").With(WithFlatLayout()).Init()
+	New("delta").With(WithFlatLayout()).Init()
+	if scopes, _ := New("delta").With(WithFlatLayout()).Scopes(); !slices.Equal(scopes, []string{"ingest"}) {
+		t.Errorf("flat Scopes() = %v, want [ingest]", scopes)
+	}
+}
+
+func TestGetOr(t *testing.T) {
+	v := New("getor-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	if got := v.GetOr("theme", "light"); got != "light" {
+		t.Errorf("GetOr on an uninitialized store = %q, want light", got)
+	}
+
+	v.Init()
+	v.Set("theme", "dark")
+	if got := v.GetOr("theme", "light"); got != "dark" {
+		t.Errorf("GetOr(theme) = %q, want dark", got)
+	}
+	if got := v.GetOr("missing", "missing"); got != "missing" {
+		t.Errorf("GetOr(missing) = %q, want the fallback", got)
+	}
+}
+
+func TestSetMany(t *testing.T) {
+	v := New("setmany-app").With(WithMetrics(&fakeMetrics{}))
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("theme", "dark")
+
+	saves := 0
+	v = v.With(WithOnChange(func(map[string]string) { saves++ }))
+	if err := v.SetMany(map[string]string{"lang": "en", "theme": "light", "db.host": "localhost"}); err != nil {
+		t.Fatalf("SetMany failed: %v", err)
+	}
+	want := map[string]string{"lang": "en", "theme": "light", "db.host": "localhost"}
+	if got, _ := v.All(); !maps.Equal(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+	if saves != 1 {
+		t.Errorf("expected a single save, got %d", saves)
+	}
+
+	if err := v.SetMany(map[string]string{"ok": "1", "a=b": "2"}); err == nil {
+		t.Error("expected SetMany to reject an invalid key")
+	}
+	if got, _ := v.All(); !maps.Equal(got, want) {
+		t.Errorf("failed SetMany modified the store: %v", got)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	v := New("duration-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	for _, want := range []time.Duration{25 * time.Minute, 90 * time.Second, 1500 * time.Millisecond, 0} {
+		if err := v.SetDuration("timeout", want); err != nil {
+			t.Fatalf("SetDuration(%v) failed: %v", want, err)
+		}
+		if got, err := v.GetDuration("timeout"); err != nil || got != want {
+			t.Errorf("GetDuration = %v, %v; want %v", got, err, want)
+		}
+	}
+
+	v.Set("default_duration", "25m")
+	if got, _ := v.GetDuration("default_duration"); got != 25*time.Minute {
+		t.Errorf("GetDuration(25m) = %v", got)
+	}
+
+	v.Set("bad", "soon")
+	_, err := v.GetDuration("bad")
+	if err == nil || !strings.Contains(err.Error(), `"bad"`) || !strings.Contains(err.Error(), `"soon"`) {
+		t.Errorf("expected an error naming the key and value, got %v", err)
+	}
+}
+
+func TestIntBoolFloat(t *testing.T) {
+	v := New("typed-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	v.SetInt("retries", -3)
+	v.SetBool("debug", true)
+	v.SetFloat("ratio", 0.25)
+	if n, err := v.GetInt("retries"); err != nil || n != -3 {
+		t.Errorf("GetInt = %d, %v; want -3", n, err)
+	}
+	if b, err := v.GetBool("debug"); err != nil || !b {
+		t.Errorf("GetBool = %v, %v; want true", b, err)
+	}
+	if f, err := v.GetFloat("ratio"); err != nil || f != 0.25 {
+		t.Errorf("GetFloat = %v, %v; want 0.25", f, err)
+	}
+	want := map[string]string{"retries": "-3", "debug": "true", "ratio": "0.25"}
+	if all, _ := v.All(); !maps.Equal(all, want) {
+		t.Errorf("stored values = %v, want %v", all, want)
+	}
+
+	// --- Case 2: Invalid values name the key and wrap the parse error ---
+	v.Set("bad", "3x")
+	_, err := v.GetInt("bad")
+	if !errors.Is(err, strconv.ErrSyntax) || !strings.Contains(err.Error(), `"bad"`) {
+		t.Errorf("expected a wrapped syntax error naming the key, got %v", err)
+	}
+	if _, err := v.GetBool("bad"); err == nil {
+		t.Error("expected GetBool to reject 3x")
+	}
+	if _, err := v.GetFloat("bad"); err == nil {
+		t.Error("expected GetFloat to reject 3x")
+	}
+}
+
+func TestCanonicalValue(t *testing.T) {
+	valid := []struct{ kind, in, want string }{
+		{"int", "007", "7"},
+		{"bool", "TRUE", "true"},
+		{"bool", "0", "false"},
+		{"float", "1.50", "1.5"},
+		{"duration", "90s", "1m30s"},
+	}
+	for _, tc := range valid {
+		if got, err := CanonicalValue(tc.kind, tc.in); err != nil || got != tc.want {
+			t.Errorf("CanonicalValue(%q, %q) = %q, %v; want %q", tc.kind, tc.in, got, err, tc.want)
+		}
+	}
+
+	// --- Case 2: The forms match those stored by the typed setters ---
+	v := New("canonical-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.SetFloat("ratio", 1.5)
+	v.SetDuration("timeout", 90*time.Second)
+	if got, _ := v.Get("ratio"); got != "1.5" {
+		t.Errorf("SetFloat stored %q, want 1.5", got)
+	}
+	if got, _ := v.Get("timeout"); got != "1m30s" {
+		t.Errorf("SetDuration stored %q, want 1m30s", got)
+	}
+
+	// --- Case 3: Errors wrap the parse error ---
+	if _, err := CanonicalValue("int", "99999999999999999999"); !errors.Is(err, strconv.ErrRange) {
+		t.Errorf("expected a wrapped range error, got %v", err)
+	}
+	if _, err := CanonicalValue("uint", "1"); err == nil {
+		t.Error("expected an unknown kind to be rejected")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	v := New("json-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	hosts := []string{"a.example.com", "b.example.com"}
+	if err := v.SetJSON("hosts", hosts); err != nil {
+		t.Fatalf("SetJSON failed: %v", err)
+	}
+	if raw, _ := v.Get("hosts"); raw != `["a.example.com","b.example.com"]` {
+		t.Errorf("expected compact JSON, got %q", raw)
+	}
+	var gotHosts []string
+	if err := v.GetJSON("hosts", &gotHosts); err != nil || !slices.Equal(gotHosts, hosts) {
+		t.Errorf("GetJSON(hosts) = %v, %v", gotHosts, err)
+	}
+
+	limits := map[string]int{"cpu": 2, "memory": 512}
+	v.SetJSON("limits", limits)
+	var gotLimits map[string]int
+	if err := v.GetJSON("limits", &gotLimits); err != nil || !maps.Equal(gotLimits, limits) {
+		t.Errorf("GetJSON(limits) = %v, %v", gotLimits, err)
+	}
+
+	v.Set("theme", "dark")
+	if err := v.GetJSON("theme", &gotHosts); err == nil {
+		t.Error("expected an error decoding a non-JSON value")
+	}
+}
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+)
+
+func parseLogLevel(s string) (logLevel, error) {
+	switch s {
+	case "debug":
+		return levelDebug, nil
+	case "info":
+		return levelInfo, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+func TestGetAs(t *testing.T) {
+	v := New("getas-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("level", "info")
+	v.Set("bad_level", "loud")
+
+	if got, err := GetAs(v, "level", parseLogLevel); err != nil || got != levelInfo {
+		t.Errorf("GetAs(level) = %v, %v; want %v", got, err, levelInfo)
+	}
+
+	// --- Case 2: Parse errors name the key and wrap the cause ---
+	got, err := GetAs(v, "bad_level", parseLogLevel)
+	if err == nil || !strings.Contains(err.Error(), `"bad_level"`) || !strings.Contains(err.Error(), `"loud"`) {
+		t.Errorf("expected an error naming the key and value, got %v", err)
+	}
+	if got != 0 {
+		t.Errorf("expected the zero value on error, got %v", got)
+	}
+
+	// --- Case 3: Missing keys are reported before parsing ---
+	called := false
+	_, err = GetAs(v, "missing", func(s string) (logLevel, error) {
+		called = true
+		return parseLogLevel(s)
+	})
+	if err == nil || called {
+		t.Errorf("GetAs(missing) = %v, parse called: %v", err, called)
+	}
+}
+
+func TestEmptyKey(t *testing.T) {
+	v := New("emptykey-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("theme", "dark")
+	before, _ := v.Raw()
+
+	for _, key := range []string{"", "   "} {
+		if err := v.Set(key, "x"); err == nil || !strings.Contains(err.Error(), "empty") {
+			t.Errorf("Set(%q) = %v, want an empty key error", key, err)
+		}
+	}
+	if err := v.SetMany(map[string]string{"lang": "en", "": "x"}); err == nil {
+		t.Error("SetMany should reject an empty key")
+	}
+	if after, _ := v.Raw(); !bytes.Equal(before, after) {
+		t.Errorf("rejected keys modified the file: %q", after)
+	}
+
+	// A stray "=x" line written by hand is skipped rather than loaded.
+	path, _ := v.Path()
+	os.WriteFile(path, []byte("=x\ntheme=dark\n"), 0600)
+	if all, _ := v.All(); !maps.Equal(all, map[string]string{"theme": "dark"}) {
+		t.Errorf("All() = %v, want only theme", all)
+	}
+	if err := v.Set("lang", "en"); err != nil {
+		t.Errorf("Set after a stray empty key failed: %v", err)
+	}
+}
+
+func TestKeyCheckedOnEveryWrite(t *testing.T) {
+	b := &memBackend{data: map[string]string{"a.x": "1"}}
+	v := New("keycheck-app").With(WithBackend(b))
+
+	for _, key := range []string{"", "bad=key\n"} {
+		if _, err := v.SetIfAbsent(key, "x"); err == nil {
+			t.Errorf("SetIfAbsent(%q) should be rejected", key)
+		}
+		if err := v.SetWithComment(key, "x", "note"); err == nil {
+			t.Errorf("SetWithComment(%q) should be rejected", key)
+		}
+		tx, _ := v.Begin()
+		if err := tx.Set(key, "x"); err == nil {
+			t.Errorf("Txn.Set(%q) should be rejected", key)
+		}
+		tx.Rollback()
+
+		d := New("keycheck-app").With(WithBackend(b))
+		d.RegisterDefault(key, "x")
+		if err := d.Reset(key); err == nil {
+			t.Errorf("Reset(%q) should be rejected", key)
+		}
+	}
+	if _, err := v.RenamePrefix("a.x", ""); err == nil {
+		t.Error("RenamePrefix to an empty key should be rejected")
+	}
+	if _, err := v.RenamePrefix("a.", "#a."); err == nil {
+		t.Error("RenamePrefix to a comment marker should be rejected")
+	}
+
+	if want := map[string]string{"a.x": "1"}; !maps.Equal(b.data, want) {
+		t.Errorf("backend data = %v, want %v", b.data, want)
+	}
+	if b.saves != 0 {
+		t.Errorf("rejected keys were saved %d times", b.saves)
+	}
+}
+
+func TestFinalNewline(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantEmpty string
+		wantFull  string
+	}{
+		{"default", nil, "", "a=1\nb=2\n"},
+		{"true", []Option{WithFinalNewline(true)}, "\n", "a=1\nb=2\n"},
+		{"false", []Option{WithFinalNewline(false)}, "", "a=1\nb=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := New("newline-app").With(tt.opts...)
+			tempDir := t.TempDir()
+			v.stateDir = func() (string, error) {
+				return tempDir, nil
+			}
+			v.InitForce()
+
+			if raw, _ := v.Raw(); string(raw) != tt.wantEmpty {
+				t.Errorf("empty store = %q, want %q", raw, tt.wantEmpty)
+			}
+			v.Set("a", "1")
+			v.Set("b", "2")
+			if raw, _ := v.Raw(); string(raw) != tt.wantFull {
+				t.Errorf("store = %q, want %q", raw, tt.wantFull)
+			}
+
+			// Appending keeps the same policy.
+			v = v.With(WithAppendMode())
+			v.Unset("b")
+			v.Set("b", "2")
+			if raw, _ := v.Raw(); string(raw) != tt.wantFull {
+				t.Errorf("appended store = %q, want %q", raw, tt.wantFull)
+			}
+		})
+	}
+}
+
+func TestModifiedSince(t *testing.T) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := base
+	v := New("times-app").With(WithKeyTimestamps(), WithClock(func() time.Time { return now }))
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	v.Set("theme", "dark")
+	v.Set("lang", "en")
+	now = base.Add(time.Hour)
+	v.Set("db.host", "localhost")
+	v.Set("lang", "en") // unchanged, keeps its old timestamp
+	now = base.Add(2 * time.Hour)
+	v.Set("theme", "light")
+
+	tests := []struct {
+		since time.Time
+		want  []string
+	}{
+		{base.Add(-time.Minute), []string{"db.host", "lang", "theme"}},
+		{base, []string{"db.host", "theme"}},
+		{base.Add(90 * time.Minute), []string{"theme"}},
+		{base.Add(3 * time.Hour), nil},
+	}
+	for _, tt := range tests {
+		got, err := v.ModifiedSince(tt.since)
+		if err != nil {
+			t.Fatalf("ModifiedSince failed: %v", err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ModifiedSince(%v) = %v, want %v", tt.since, got, tt.want)
+		}
+	}
+
+	// --- Removed keys are forgotten ---
+	v.Unset("db.host")
+	if got, _ := v.ModifiedSince(base); !slices.Equal(got, []string{"theme"}) {
+		t.Errorf("ModifiedSince after Unset = %v, want [theme]", got)
+	}
+
+	// --- Destroy removes the sidecar file too ---
+	path, _ := v.Path()
+	if err := v.Destroy(); err != nil {
+		t.Fatalf("Destroy failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(path)); !os.IsNotExist(err) {
+		t.Errorf("expected the namespace directory to be removed, got %v", err)
+	}
+
+	if _, err := New("times-app").ModifiedSince(base); err == nil {
+		t.Error("ModifiedSince should fail without WithKeyTimestamps")
+	}
+}
+
+func TestReset(t *testing.T) {
+	v := New("reset-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.RegisterDefault("theme", "dark")
+
+	// --- Case 1: Reset restores the registered default ---
+	v.Set("theme", "neon")
+	if err := v.Reset("theme"); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if got, _ := v.Get("theme"); got != "dark" {
+		t.Errorf("theme after Reset = %q, want dark", got)
+	}
+
+	// --- Case 2: Reset without a default removes the key ---
+	v.Set("lang", "fr")
+	if err := v.Reset("lang"); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if ok, _ := v.Has("lang"); ok {
+		t.Error("expected lang to be removed")
+	}
+
+	// --- Case 3: Get falls back to defaults only when asked ---
+	v.Unset("theme")
+	if _, err := v.Get("theme"); err == nil {
+		t.Error("Get should not use defaults without WithDefaultFallback")
+	}
+	v = v.With(WithDefaultFallback())
+	if got, err := v.Get("theme"); err != nil || got != "dark" {
+		t.Errorf("Get with fallback = %q, %v; want dark", got, err)
+	}
+	if ok, _ := v.Has("theme"); ok {
+		t.Error("the fallback must not write the default to the store")
+	}
+}
+
+func TestResetAll(t *testing.T) {
+	v := New("resetall-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.RegisterDefault("theme", "dark")
+	v.RegisterDefault("lang", "en")
+
+	v.Set("theme", "neon")
+	v.Set("extra", "1")
+	if err := v.ResetAll(); err != nil {
+		t.Fatalf("ResetAll failed: %v", err)
+	}
+	want := map[string]string{"theme": "dark", "lang": "en"}
+	if got, _ := v.All(); !maps.Equal(got, want) {
+		t.Errorf("All() after ResetAll = %v, want %v", got, want)
+	}
+}
+
+func TestInitWithSeed(t *testing.T) {
+	v := New("seed-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	seed := map[string]string{"theme": "dark", "lang": "en"}
+	if err := v.InitWithSeed(seed); err != nil {
+		t.Fatalf("InitWithSeed failed: %v", err)
+	}
+	if got, _ := v.All(); !maps.Equal(got, seed) {
+		t.Errorf("All() after seeding = %v, want %v", got, seed)
+	}
+
+	v.Set("theme", "light")
+	if err := v.InitWithSeed(map[string]string{"theme": "neon", "new": "1"}); err != nil {
+		t.Fatalf("second InitWithSeed failed: %v", err)
+	}
+	want := map[string]string{"theme": "light", "lang": "en"}
+	if got, _ := v.All(); !maps.Equal(got, want) {
+		t.Errorf("second seed modified existing data: %v, want %v", got, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	v := New("diff-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.SetMany(map[string]string{"theme": "dark", "lang": "en", "db.host": "localhost"})
+
+	changes, err := v.Diff(map[string]string{"theme": "light", "db.host": "localhost", "url": "https://x.io"})
+	if err != nil {
+		t.Fatalf("Diff failed: %v", err)
+	}
+	want := []Change{
+		{Key: "lang", Kind: Removed, Old: "en"},
+		{Key: "theme", Kind: Changed, Old: "dark", New: "light"},
+		{Key: "url", Kind: Added, New: "https://x.io"},
+	}
+	if !slices.Equal(changes, want) {
+		t.Errorf("Diff() = %v, want %v", changes, want)
+	}
+
+	if changes, _ := v.Diff(map[string]string{"theme": "dark", "lang": "en", "db.host": "localhost"}); len(changes) != 0 {
+		t.Errorf("expected no changes for identical data, got %v", changes)
+	}
+}
+
+func TestSharedLock(t *testing.T) {
+	tempDir := t.TempDir()
+	stateDir := func() (string, error) {
+		return tempDir, nil
+	}
+	a := New("shared-lock")
+	a.stateDir = stateDir
+	b := New("shared-lock")
+	b.stateDir = stateDir
+	a.Init()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 25; i++ {
+		wg.Go(func() { a.Set(fmt.Sprintf("a_%d", i), "1") })
+		wg.Go(func() { b.Set(fmt.Sprintf("b_%d", i), "1") })
+	}
+	wg.Wait()
+
+	all, err := a.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 50 {
+		t.Errorf("expected 50 keys from both instances, got %d (lost updates)", len(all))
+	}
+
+	// --- Case 2: Unlocking releases the locked mutex if the path changes ---
+	dir := tempDir
+	c := New("shared-lock")
+	c.stateDir = func() (string, error) {
+		return dir, nil
+	}
+	if err := c.lock(); err != nil {
+		t.Fatal(err)
+	}
+	dir = t.TempDir()
+	c.unlock()
+	if !a.mutex().TryLock() {
+		t.Fatal("expected the shared lock to be released")
+	}
+	a.mutex().Unlock()
+}
+
+func TestRenameToFlat(t *testing.T) {
+	tempDir := t.TempDir()
+	stateDir := func() (string, error) {
+		return tempDir, nil
+	}
+	src := New("rename-app", "ingest").With(WithFlatLayout(), WithKeyTimestamps())
+	src.stateDir = stateDir
+	dst := New("rename-app", "import").With(WithFlatLayout(), WithKeyTimestamps())
+	dst.stateDir = stateDir
+
+	src.Init()
+	src.Set("batch", "10")
+	if err := src.RenameTo(dst); err != nil {
+		t.Fatalf("RenameTo failed: %v", err)
+	}
+	if got, _ := dst.Get("batch"); got != "10" {
+		t.Errorf("batch after rename = %q", got)
+	}
+	if keys, _ := dst.ModifiedSince(time.Time{}); !slices.Equal(keys, []string{"batch"}) {
+		t.Errorf("timestamps were not moved: %v", keys)
+	}
+	if ok, _ := src.IsInitialized(); ok {
+		t.Error("expected the old scope to be gone")
+	}
+	if err := src.RenameTo(dst); err == nil {
+		t.Error("expected renaming a missing store to fail")
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	srcDir := t.TempDir()
+	root := New("archive-app")
+	root.stateDir = func() (string, error) { return srcDir, nil }
+	scoped := New("archive-app", "dev")
+	scoped.stateDir = root.stateDir
+
+	root.Init()
+	root.Set("region", "eu")
+	scoped.Init()
+	scoped.Set("debug", "true")
+
+	var buf bytes.Buffer
+	if err := root.ExportArchive(&buf); err != nil {
+		t.Fatalf("ExportArchive failed: %v", err)
+	}
+
+	dstDir := t.TempDir()
+	restored := New("archive-app")
+	restored.stateDir = func() (string, error) { return dstDir, nil }
+	if err := restored.ImportArchive(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("ImportArchive failed: %v", err)
+	}
+	if got, _ := restored.Get("region"); got != "eu" {
+		t.Errorf("region = %q, want eu", got)
+	}
+	restoredScope := New("archive-app", "dev")
+	restoredScope.stateDir = restored.stateDir
+	if got, _ := restoredScope.Get("debug"); got != "true" {
+		t.Errorf("dev debug = %q, want true", got)
+	}
+
+	// --- Case: entries escaping the namespace are rejected ---
+	for _, name := range []string{"../evil.properties", "/etc/evil", "dev/../../evil"} {
+		var evil bytes.Buffer
+		tw := tar.NewWriter(&evil)
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600, Size: 1})
+		tw.Write([]byte("x"))
+		tw.Close()
+		if err := restored.ImportArchive(&evil); err == nil {
+			t.Errorf("expected %q to be rejected", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "evil.properties")); !os.IsNotExist(err) {
+		t.Error("an entry was written outside the namespace directory")
+	}
+
+	// --- Case: every store touched is locked, not just v's own ---
+	holder := New("archive-app", "dev")
+	holder.stateDir = restored.stateDir
+	if err := holder.lock(); err != nil {
+		t.Fatal(err)
+	}
+	impatient := New("archive-app").With(WithLockTimeout(20 * time.Millisecond))
+	impatient.stateDir = restored.stateDir
+	if err := impatient.ImportArchive(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("ImportArchive with a scope locked = %v, want ErrLockTimeout", err)
+	}
+	if err := impatient.ExportArchive(io.Discard); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("ExportArchive with a scope locked = %v, want ErrLockTimeout", err)
+	}
+	holder.unlock()
+	if err := impatient.ImportArchive(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Errorf("ImportArchive after the scope was unlocked failed: %v", err)
+	}
+}
+
+func TestArchiveLockOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	root := New("archive-order")
+	root.stateDir = func() (string, error) { return tempDir, nil }
+	scoped := New("archive-order", "dev").With(WithScopeInheritsRoot())
+	scoped.stateDir = root.stateDir
+	root.Init()
+	root.Set("region", "eu")
+	scoped.Init()
+	scoped.Set("debug", "true")
+
+	var buf bytes.Buffer
+	if err := root.ExportArchive(&buf); err != nil {
+		t.Fatalf("ExportArchive failed: %v", err)
+	}
+
+	// Imports lock the scope and the root, while reads of a scope that
+	// inherits the root hold the scope's lock and take the root's.
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for range 4 {
+			wg.Go(func() {
+				for range 50 {
+					root.ImportArchive(bytes.NewReader(buf.Bytes()))
+				}
+			})
+			wg.Go(func() {
+				for range 50 {
+					root.ExportArchive(io.Discard)
+				}
+			})
+			wg.Go(func() {
+				for range 200 {
+					scoped.Get("region")
+				}
+			})
+		}
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatal("archive operations deadlocked with reads of an inheriting scope")
+	}
+}
+
+func TestImportReport(t *testing.T) {
+	v := New("import-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("keep", "1")
+
+	input := "# imported settings\n" +
+		"theme=dark\n" +
+		"not a pair\n" +
+		"\n" +
+		"lang = en\n" +
+		"=orphan\n" +
+		"theme=light\n"
+	applied, errs, err := v.ImportReport(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ImportReport failed: %v", err)
+	}
+	if applied != 3 {
+		t.Errorf("applied = %d, want 3", applied)
+	}
+	var lines []int
+	for _, e := range errs {
+		lines = append(lines, e.Line)
+	}
+	if !slices.Equal(lines, []int{3, 6}) {
+		t.Errorf("error lines = %v, want [3 6] (%v)", lines, errs)
+	}
+	if len(errs) == 2 && !strings.Contains(errs[1].Reason, "key cannot be empty") {
+		t.Errorf("unexpected reason for line 6: %q", errs[1].Reason)
+	}
+
+	want := map[string]string{"keep": "1", "theme": "light", "lang": "en"}
+	if got, _ := v.All(); !maps.Equal(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+}
+
+func TestChangeLog(t *testing.T) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := base
+	v := New("log-app").With(WithChangeLog(3), WithClock(func() time.Time { return now }))
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	v.Set("theme", "dark")
+	now = base.Add(time.Minute)
+	v.Set("theme", "light")
+	v.Set("theme", "light") // unchanged, not logged
+	now = base.Add(2 * time.Minute)
+	v.Unset("theme")
+
+	entries, err := v.ChangeLog()
+	if err != nil {
+		t.Fatalf("ChangeLog failed: %v", err)
+	}
+	want := []LogEntry{
+		{base, Change{Key: "theme", Kind: Added, New: "dark"}},
+		{base.Add(time.Minute), Change{Key: "theme", Kind: Changed, Old: "dark", New: "light"}},
+		{base.Add(2 * time.Minute), Change{Key: "theme", Kind: Removed, Old: "light"}},
+	}
+	if !slices.EqualFunc(entries, want, func(a, b LogEntry) bool { return a.Time.Equal(b.Time) && a.Change == b.Change }) {
+		t.Errorf("ChangeLog() = %v, want %v", entries, want)
+	}
+
+	// --- Case 2: The log keeps only the most recent entries ---
+	v.Set("lang", "en")
+	entries, _ = v.ChangeLog()
+	if len(entries) != 3 || entries[0].Kind != Changed || entries[2].Key != "lang" {
+		t.Errorf("expected the oldest entry to be dropped, got %v", entries)
+	}
+
+	if _, err := New("log-app").ChangeLog(); err == nil {
+		t.Error("expected an error without WithChangeLog")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	var audit bytes.Buffer
+	v := New("audit-app", "dev").With(WithAuditLog(&audit), WithClock(func() time.Time { return now }))
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	v.Set("theme", "dark")
+	v.Set("theme", "light")
+	v.Unset("theme")
+	v.Unset("theme") // already gone, not audited
+	want := `{"time":"2025-01-01T12:00:00Z","namespace":"audit-app","scope":"dev","op":"set","key":"theme","new":"dark"}` + "\n" +
+		`{"time":"2025-01-01T12:00:00Z","namespace":"audit-app","scope":"dev","op":"set","key":"theme","old":"dark","new":"light"}` + "\n" +
+		`{"time":"2025-01-01T12:00:00Z","namespace":"audit-app","scope":"dev","op":"unset","key":"theme","old":"light"}` + "\n"
+	if audit.String() != want {
+		t.Errorf("audit log =\n%s\nwant\n%s", audit.String(), want)
+	}
+
+	// --- Case 2: Failed operations are not audited ---
+	audit.Reset()
+	if err := v.Set("bad=key", "x"); err == nil {
+		t.Fatal("expected an invalid key to be rejected")
+	}
+	if err := v.SetMany(map[string]string{"ok": "1", "#bad": "2"}); err == nil {
+		t.Fatal("expected an invalid key to be rejected")
+	}
+	if audit.Len() != 0 {
+		t.Errorf("failed writes were audited: %q", audit.String())
+	}
+
+	// --- Case 3: InitForce audits every key it discards ---
+	v.SetMany(map[string]string{"a": "1", "b": "2"})
+	audit.Reset()
+	v.InitForce()
+	if n := strings.Count(audit.String(), `"op":"unset"`); n != 2 {
+		t.Errorf("expected 2 unset entries from InitForce, got %q", audit.String())
+	}
+}
+
+func TestBackupOnWrite(t *testing.T) {
+	const n = 3
+	v := New("backup-app").With(WithBackupOnWrite(n))
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	// The first write backs up the empty file from Init.
+	for i := 1; i <= n+2; i++ {
+		if err := v.Set("count", fmt.Sprint(i)); err != nil {
+			t.Fatalf("Set #%d failed: %v", i, err)
+		}
+	}
+
+	dir := filepath.Join(tempDir, "backup-app")
+	for gen := 1; gen <= n; gen++ {
+		got, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("vars.properties.%d", gen)))
+		if want := fmt.Sprintf("count=%d\n", n+2-gen); err != nil || string(got) != want {
+			t.Errorf("backup %d = %q, %v; want %q", gen, got, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("vars.properties.%d", n+1))); !os.IsNotExist(err) {
+		t.Errorf("expected backups beyond %d to be pruned, got %v", n, err)
+	}
+
+	// --- Case 2: Destroy removes the backups along with the store ---
+	if err := v.Destroy(); err != nil {
+		t.Fatalf("Destroy failed: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected the directory to be removed, got %v", err)
+	}
+
+	// --- Case 3: A retried save rotates the backups only once ---
+	retried := New("backup-retry").With(WithBackupOnWrite(n), WithRetry(3, time.Millisecond))
+	retried.stateDir = v.stateDir
+	retried.Init()
+	retried.Set("count", "1")
+	retried.Set("count", "2")
+	flaky := &flakySaveBackend{fileBackend: fileBackend{retried}, failures: 1}
+	retried.backend = flaky
+	if err := retried.Set("count", "3"); err != nil || flaky.failures != 0 {
+		t.Fatalf("Set after a transient failure = %v (failures left %d)", err, flaky.failures)
+	}
+	retryDir := filepath.Join(tempDir, "backup-retry")
+	for gen, want := range map[int]string{1: "count=2\n", 2: "count=1\n", 3: ""} {
+		got, err := os.ReadFile(filepath.Join(retryDir, fmt.Sprintf("vars.properties.%d", gen)))
+		if err != nil || string(got) != want {
+			t.Errorf("backup %d after a retried save = %q, %v; want %q", gen, got, err, want)
+		}
+	}
+
+	// --- Case 4: A flat-layout rename moves the backups with the scope ---
+	src := New("backup-app", "ingest").With(WithFlatLayout(), WithBackupOnWrite(n))
+	src.stateDir = v.stateDir
+	dst := New("backup-app", "import").With(WithFlatLayout(), WithBackupOnWrite(n))
+	dst.stateDir = v.stateDir
+	src.Init()
+	src.Set("count", "1")
+	src.Set("count", "2")
+	if err := src.RenameTo(dst); err != nil {
+		t.Fatalf("RenameTo failed: %v", err)
+	}
+	for gen, want := range map[int]string{1: "count=1\n", 2: ""} {
+		got, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("import.properties.%d", gen)))
+		if err != nil || string(got) != want {
+			t.Errorf("moved backup %d = %q, %v; want %q", gen, got, err, want)
+		}
+		if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("ingest.properties.%d", gen))); !os.IsNotExist(err) {
+			t.Errorf("expected backup %d to leave the old name, got %v", gen, err)
+		}
+	}
+}
+
+// flakySaveBackend is the file backend with its first saves reporting a
+// transient error once the file is written, as a failed sync would.
+type flakySaveBackend struct {
+	fileBackend
+	failures int
+}
+
+func (b *flakySaveBackend) SaveWithComments(data, comments map[string]string) error {
+	err := b.fileBackend.SaveWithComments(data, comments)
+	if err == nil && b.failures > 0 {
+		b.failures--
+		return fmt.Errorf("sync vars: %w", syscall.EAGAIN)
+	}
+	return err
+}
+
+// naturalLess orders keys with runs of digits compared by value, so that
+// "item2" sorts before "item10".
+func naturalLess(a, b string) bool {
+	re := regexp.MustCompile(`\d+|\D+`)
+	pa, pb := re.FindAllString(a, -1), re.FindAllString(b, -1)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if pa[i] == pb[i] {
+			continue
+		}
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		if errA == nil && errB == nil {
+			return na < nb
+		}
+		return pa[i] < pb[i]
+	}
+	return len(pa) < len(pb)
+}
+
+func TestKeyOrder(t *testing.T) {
+	v := New("order-app").With(WithKeyOrder(naturalLess))
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.SetMany(map[string]string{"item10": "c", "item2": "b", "item1": "a", "alpha": "x"})
+
+	raw, _ := v.Raw()
+	if want := "alpha=x\nitem1=a\nitem2=b\nitem10=c\n"; string(raw) != want {
+		t.Errorf("file = %q, want %q", raw, want)
+	}
+	keys, _ := v.KeysWhere(func(k, _ string) bool { return strings.HasPrefix(k, "item") })
+	if want := []string{"item1", "item2", "item10"}; !slices.Equal(keys, want) {
+		t.Errorf("KeysWhere = %v, want %v", keys, want)
+	}
+
+	// --- Case 2: The default order stays lexicographic ---
+	plain := New("order-app")
+	plain.stateDir = v.stateDir
+	plain.Set("alpha", "y")
+	if raw, _ := plain.Raw(); string(raw) != "alpha=y\nitem1=a\nitem10=c\nitem2=b\n" {
+		t.Errorf("default order = %q", raw)
+	}
+}
+
+func TestAllWithComments(t *testing.T) {
+	v := New("entries-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	fixture := "# UI color scheme\n" +
+		"theme=dark\n" +
+		"\n" +
+		"# detached comment, not attached to a key\n" +
+		"\n" +
+		"lang=en\n" +
+		"# Connection string\n" +
+		"# for the primary database\n" +
+		"db.url=postgres://localhost\n"
+	os.WriteFile(filepath.Join(tempDir, "entries-app", "vars.properties"), []byte(fixture), 0600)
+
+	got, err := v.AllWithComments()
+	if err != nil {
+		t.Fatalf("AllWithComments failed: %v", err)
+	}
+	want := map[string]Entry{
+		"theme":  {Value: "dark", Comment: "UI color scheme"},
+		"lang":   {Value: "en"},
+		"db.url": {Value: "postgres://localhost", Comment: "Connection string\nfor the primary database"},
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("AllWithComments() = %q, want %q", got, want)
+	}
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	changes := 0
+	v := New("skip-app").With(WithSkipUnchanged(), WithOnChange(func(map[string]string) { changes++ }))
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.Set("theme", "dark")
+
+	file := filepath.Join(tempDir, "skip-app", "vars.properties")
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(file, past, past)
+
+	if err := v.Set("theme", "dark"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if info, _ := os.Stat(file); !info.ModTime().Equal(past) {
+		t.Errorf("identical Set modified the file: mtime %v, want %v", info.ModTime(), past)
+	}
+	if changes != 1 {
+		t.Errorf("OnChange called %d times, want 1", changes)
+	}
+
+	// --- Case 2: A real change, or a new comment, is still written ---
+	v.Set("theme", "light")
+	if info, _ := os.Stat(file); info.ModTime().Equal(past) {
+		t.Error("changed value was not written")
+	}
+	os.Chtimes(file, past, past)
+	v.SetWithComment("theme", "light", "UI color scheme")
+	if info, _ := os.Stat(file); info.ModTime().Equal(past) {
+		t.Error("changed comment was not written")
+	}
+	if changes != 3 {
+		t.Errorf("OnChange called %d times, want 3", changes)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	v := New("query-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.SetMany(map[string]string{
+		"pomodoro.timer": "25m",
+		"break.timer":    "5m",
+		"long.timer":     "25m",
+		"greeting":       "hello world",
+		"debug":          "on",
+	})
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"key~=timer", []string{"break.timer", "long.timer", "pomodoro.timer"}},
+		{"value=25m", []string{"long.timer", "pomodoro.timer"}},
+		{"key=*.timer AND value=5m", []string{"break.timer"}},
+		{"key~=timer AND value=25m", []string{"long.timer", "pomodoro.timer"}},
+		{"key~=pomodoro and value=25m OR key=debug", []string{"debug", "pomodoro.timer"}},
+		{`value="hello world"`, []string{"greeting"}},
+		{"value~=world OR value~=nothing", []string{"greeting"}},
+		{"key=missing", nil},
+	}
+	for _, tt := range tests {
+		got, err := v.Query(tt.expr)
+		if err != nil {
+			t.Errorf("Query(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if keys := slices.Sorted(maps.Keys(got)); !slices.Equal(keys, tt.want) {
+			t.Errorf("Query(%q) = %v, want %v", tt.expr, keys, tt.want)
+		}
+	}
+
+	// --- Case 2: Parse errors name the offending token ---
+	for expr, token := range map[string]string{
+		"":                       "empty",
+		"name=x":                 `"name=x"`,
+		"key~=timer XOR value=1": `"XOR"`,
+		"key~=timer AND":         `"AND"`,
+		"timer":                  `"timer"`,
+		"key=[":                  `"key=["`,
+	} {
+		if _, err := v.Query(expr); err == nil || !strings.Contains(err.Error(), token) {
+			t.Errorf("Query(%q) error = %v, want it to mention %s", expr, err, token)
+		}
+	}
+}
+
+func TestLockTimeout(t *testing.T) {
+	tempDir := t.TempDir()
+	stateDir := func() (string, error) {
+		return tempDir, nil
+	}
+	holder := New("timeout-app")
+	holder.stateDir = stateDir
+	holder.Init()
+
+	const timeout = 50 * time.Millisecond
+	v := New("timeout-app").With(WithLockTimeout(timeout))
+	v.stateDir = stateDir
+
+	if err := holder.lock(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err := v.Set("theme", "dark")
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("Set while locked = %v, want ErrLockTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Errorf("Set gave up after %v, before the %v timeout", elapsed, timeout)
+	}
+	if _, err := v.Get("theme"); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("Get while locked = %v, want ErrLockTimeout", err)
+	}
+
+	// --- Case 2: A lock released before the deadline is acquired ---
+	go func() {
+		time.Sleep(timeout / 5)
+		holder.unlock()
+	}()
+	if err := v.Set("theme", "dark"); err != nil {
+		t.Errorf("Set after release failed: %v", err)
+	}
+}
+
+func TestScopeInheritsRoot(t *testing.T) {
+	tempDir := t.TempDir()
+	stateDir := func() (string, error) {
+		return tempDir, nil
+	}
+	root := New("inherit-app")
+	root.stateDir = stateDir
+	v := New("inherit-app", "dev").With(WithScopeInheritsRoot())
+	v.stateDir = stateDir
+
+	// --- Case 1: An uninitialized root contributes nothing ---
+	v.Init()
+	v.Set("theme", "dark")
+	if got, err := v.All(); err != nil || !maps.Equal(got, map[string]string{"theme": "dark"}) {
+		t.Errorf("All() without a root = %v, %v", got, err)
+	}
+
+	root.Init()
+	root.SetMany(map[string]string{"theme": "light", "region": "eu"})
+
+	// --- Case 2: Missing keys fall back to the root, scope values win ---
+	if got, err := v.Get("region"); err != nil || got != "eu" {
+		t.Errorf("Get(region) = %q, %v; want inherited eu", got, err)
+	}
+	if got, _ := v.Get("theme"); got != "dark" {
+		t.Errorf("Get(theme) = %q, want the scope's dark", got)
+	}
+	if ok, _ := v.Has("region"); !ok {
+		t.Error("Has(region) should see the inherited key")
+	}
+	want := map[string]string{"theme": "dark", "region": "eu"}
+	if got, _ := v.All(); !maps.Equal(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+
+	// --- Case 3: Render, comments and transactions see the root too ---
+	root.Set("host", "db.internal")
+	root.SetWithComment("port", "5432", "Database port")
+	v.Set("url", "${host}:${port}")
+	if got, err := v.Render("url"); err != nil || got != "db.internal:5432" {
+		t.Errorf("Render(url) = %q, %v; want db.internal:5432", got, err)
+	}
+	if got, err := v.GetComment("port"); err != nil || got != "Database port" {
+		t.Errorf("GetComment(port) = %q, %v; want the root's comment", got, err)
+	}
+	if entries, _ := v.AllWithComments(); entries["port"] != (Entry{Value: "5432", Comment: "Database port"}) {
+		t.Errorf("AllWithComments()[port] = %+v", entries["port"])
+	}
+	tx, err := v.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := tx.Get("host"); err != nil || got != "db.internal" {
+		t.Errorf("Txn.Get(host) = %q, %v; want db.internal", got, err)
+	}
+	tx.Rollback()
+	v.Unset("url")
+	root.Unset("host")
+	root.Unset("port")
+
+	// --- Case 4: Writes go only to the scope ---
+	v.Set("region", "us")
+	if got, _ := root.Get("region"); got != "eu" {
+		t.Errorf("root region = %q, want eu unchanged", got)
+	}
+	v.Unset("region")
+	if got, _ := v.Get("region"); got != "eu" {
+		t.Errorf("Get(region) after unset = %q, want inherited eu", got)
+	}
+	raw, _ := v.Raw()
+	if string(raw) != "theme=dark\n" {
+		t.Errorf("scope file = %q, want only its own keys", raw)
+	}
+
+	// Without the option the scope stands alone.
+	plain := New("inherit-app", "dev")
+	plain.stateDir = stateDir
+	if _, err := plain.Get("region"); err == nil {
+		t.Error("expected no inheritance without WithScopeInheritsRoot")
+	}
+}
+
+func TestScope(t *testing.T) {
+	tempDir := t.TempDir()
+	v := New("scope-app").With(WithCaseInsensitiveKeys())
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+
+	dev, err := v.Scope("dev")
+	if err != nil {
+		t.Fatalf("Scope(dev) failed: %v", err)
+	}
+	dev.Init()
+	dev.Set("Theme", "dark")
+	if got, _ := os.ReadFile(filepath.Join(tempDir, "scope-app", "dev", "vars.properties")); string(got) != "theme=dark\n" {
+		t.Errorf("scoped file = %q, want the parent's options and state dir applied", got)
+	}
+	if ok, _ := v.IsInitialized(); ok {
+		t.Error("opening a scope should not initialize the parent")
+	}
+
+	// --- Case 2: Nesting and invalid scopes are rejected ---
+	if _, err := dev.Scope("eu"); err == nil || !strings.Contains(err.Error(), "nesting") {
+		t.Errorf("Scope on a scoped Vars = %v, want a nesting error", err)
+	}
+	for _, scope := range []string{"", "a/b", `a\b`, "..", "bad name"} {
+		if _, err := v.Scope(scope); err == nil {
+			t.Errorf("Scope(%q) should fail", scope)
+		}
+	}
+}
+
+func TestEquals(t *testing.T) {
+	v := New("equals-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.SetMany(map[string]string{"primary.host": "db1", "replica.host": "db1", "backup.host": "db2"})
+
+	if eq, err := v.Equals("primary.host", "replica.host"); err != nil || !eq {
+		t.Errorf("Equals(primary, replica) = %v, %v; want true", eq, err)
+	}
+	if eq, err := v.Equals("primary.host", "backup.host"); err != nil || eq {
+		t.Errorf("Equals(primary, backup) = %v, %v; want false", eq, err)
+	}
+	for _, keys := range [][2]string{{"missing", "primary.host"}, {"primary.host", "missing"}} {
+		if _, err := v.Equals(keys[0], keys[1]); err == nil || !strings.Contains(err.Error(), "missing") {
+			t.Errorf("Equals(%q, %q) = %v, want an error naming the missing key", keys[0], keys[1], err)
+		}
+	}
+}
+
+func TestMirrorEnvFile(t *testing.T) {
+	tempDir := t.TempDir()
+	envFile := filepath.Join(t.TempDir(), ".env")
+	v := New("mirror-app").With(WithMirrorEnvFile(envFile))
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+
+	v.Set("db.host", "localhost")
+	v.Set("greeting", `say "hi" to $USER`)
+	got, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatalf("mirror not written: %v", err)
+	}
+	want := `DB_HOST="localhost"` + "\n" + `GREETING="say \"hi\" to \$USER"` + "\n"
+	if string(got) != want {
+		t.Errorf("mirror = %q, want %q", got, want)
+	}
+
+	v.Unset("greeting")
+	if got, _ := os.ReadFile(envFile); string(got) != `DB_HOST="localhost"`+"\n" {
+		t.Errorf("mirror after Unset = %q", got)
+	}
+
+	// --- Case 2: A failed mirror is reported, but the store is saved ---
+	broken := New("mirror-app").With(WithMirrorEnvFile(filepath.Join(tempDir, "missing", ".env")))
+	broken.stateDir = v.stateDir
+	err = broken.Set("lang", "en")
+	if err == nil || !strings.Contains(err.Error(), "mirror") {
+		t.Errorf("expected a mirror error, got %v", err)
+	}
+	if got, _ := v.Get("lang"); got != "en" {
+		t.Errorf("store not saved when the mirror failed: lang = %q", got)
+	}
+}
+
+func TestGetExpanded(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("VARS_TEST_DIR", "projects")
+	t.Setenv("VARS_TEST_EMPTY", "")
+
+	v := New("expand-app")
+	tempDir := t.TempDir()
+	v.stateDir = func() (string, error) {
+		return tempDir, nil
+	}
+	v.Init()
+	v.SetMany(map[string]string{
+		"docs":     "~/Documents",
+		"home":     "~",
+		"other":    "~other/x",
+		"braced":   "${HOME}/${VARS_TEST_DIR}",
+		"plain":    "$HOME/x",
+		"empty":    "a${VARS_TEST_EMPTY}b",
+		"undefine": "$VARS_TEST_UNDEFINED/cache",
+	})
+
+	tests := map[string]string{
+		"docs":     home + "/Documents",
+		"home":     home,
+		"other":    "~other/x",
+		"braced":   home + "/projects",
+		"plain":    home + "/x",
+		"empty":    "ab",
+		"undefine": "/cache",
+	}
+	for key, want := range tests {
+		if got, err := v.GetExpanded(key); err != nil || got != want {
+			t.Errorf("GetExpanded(%q) = %q, %v; want %q", key, got, err, want)
+		}
+	}
+
+	// --- Case 2: Undefined variables are an error with WithStrictExpand ---
+	v.With(WithStrictExpand())
+	if _, err := v.GetExpanded("undefine"); err == nil || !strings.Contains(err.Error(), "VARS_TEST_UNDEFINED") {
+		t.Errorf("expected an error naming the undefined variable, got %v", err)
+	}
+	if got, err := v.GetExpanded("empty"); err != nil || got != "ab" {
+		t.Errorf("a set but empty variable should expand, got %q, %v", got, err)
+	}
+}
+
+func TestValues(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	v := New("values-app")
+	v.Init()
+	v.SetMany(map[string]string{"server.c": "10.0.0.3", "server.a": "10.0.0.1", "server.b": "10.0.0.2"})
+
+	want := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	if got, err := v.Values(); err != nil || !slices.Equal(got, want) {
+		t.Errorf("Values() = %v, %v; want %v", got, err, want)
+	}
+
+	rootCmd := NewCmd("values-app")
+	buf := new(bytes.Buffer)
+	rootCmd.SetOut(buf)
+	rootCmd.SetErr(buf)
+	rootCmd.SetArgs([]string{"values"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("CLI Values failed: %v", err)
+	}
+	if got := buf.String(); got != "10.0.0.1\n10.0.0.2\n10.0.0.3\n" {
+		t.Errorf("values output = %q", got)
+	}
+}
@@ -0,0 +1,51 @@
+package vars
+
+import (
+	"context"
+	"maps"
+	"time"
+)
+
+// Watch polls the store every interval and sends a copy of its contents on
+// the returned channel each time they differ from the previous poll. The
+// channel is closed once ctx is cancelled.
+//
+// The store must be readable when Watch is called; the initial contents are
+// not sent. Load errors while polling, such as the file being briefly
+// missing, are skipped and the previous contents are kept for comparison.
+func (v *Vars) Watch(ctx context.Context, interval time.Duration) (<-chan map[string]string, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	last, err := v.All()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan map[string]string)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			m, err := v.All()
+			if err != nil || maps.Equal(m, last) {
+				continue
+			}
+			last = m
+			select {
+			case ch <- maps.Clone(m):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}